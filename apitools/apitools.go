@@ -59,10 +59,14 @@ func (s Endpoint) FormatQuery(query url.Values, path ...string) string {
 	return formattedURL
 }
 
-func NewHTTPClientWrapper(endpoint Endpoint) *HTTPClientWrapper {
+func NewHTTPClientWrapper(endpoint Endpoint, httpClient *http.Client) *HTTPClientWrapper {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
 	return &HTTPClientWrapper{
 		Endpoint:   endpoint,
-		httpClient: &http.Client{},
+		httpClient: httpClient,
 	}
 }
 
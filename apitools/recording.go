@@ -0,0 +1,440 @@
+package apitools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redactedValue = "REDACTED"
+
+// sensitiveFields are query parameters, form fields and JSON keys that carry
+// credentials. They are compared without regard to case.
+var sensitiveFields = map[string]struct{}{
+	"user":          {},
+	"username":      {},
+	"pass":          {},
+	"password":      {},
+	"auth":          {},
+	"token":         {},
+	"apikey":        {},
+	"api_key":       {},
+	"access_token":  {},
+	"refresh_token": {},
+	"credentials":   {},
+}
+
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// sensitiveAssignment matches credentials embedded in text as name=value, for
+// example the auth token Zoneminder adds to stream URLs in its pages
+var sensitiveAssignment = func() *regexp.Regexp {
+	names := make([]string, 0, len(sensitiveFields))
+	for name := range sensitiveFields {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+
+	sort.Strings(names)
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(names, "|") + `)=[^&"'\s<>;]+`)
+}()
+
+// cakeFilterValue matches the value of a CakePHP named parameter path filter
+// such as "StartTime >=:2024-01-01 00:00:00" up to a trailing .json
+var cakeFilterValue = regexp.MustCompile(`:[^/]*?(\.json)?$`)
+
+func isSensitiveField(name string) bool {
+	_, sensitive := sensitiveFields[strings.ToLower(name)]
+	return sensitive
+}
+
+// isRecordedContent reports whether a body is text that is recorded inline.
+// Anything else, such as event video, archive exports and snapshots, is passed
+// through without being buffered or recorded.
+func isRecordedContent(header http.Header) bool {
+	contentType := strings.ToLower(header.Get("Content-Type"))
+
+	return len(contentType) == 0 ||
+		strings.HasPrefix(contentType, "text/") ||
+		strings.HasPrefix(contentType, "application/x-www-form-urlencoded") ||
+		strings.Contains(contentType, "json")
+}
+
+// normalizePath drops the values of CakePHP path filters so that requests for
+// the same filter match regardless of the time or ID they were made with
+func normalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for idx, segment := range segments {
+		if strings.Contains(segment, ":") {
+			segments[idx] = cakeFilterValue.ReplaceAllString(segment, ":$1")
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// RecordedExchange is a single request and response pair with all credentials
+// replaced by a placeholder
+type RecordedExchange struct {
+	RecordedAt      time.Time   `json:"recorded_at"`
+	Method          string      `json:"method"`
+	Path            string      `json:"path"`
+	Query           string      `json:"query"`
+	RequestHeader   http.Header `json:"request_header"`
+	RequestBody     []byte      `json:"request_body,omitempty"`
+	StatusCode      int         `json:"status_code"`
+	ResponseHeader  http.Header `json:"response_header"`
+	ResponseBody    []byte      `json:"response_body,omitempty"`
+	TransportFailed string      `json:"transport_failed,omitempty"`
+
+	// ResponseStreamed is set when the response body was passed through
+	// without being recorded
+	ResponseStreamed bool `json:"response_streamed,omitempty"`
+}
+
+func (s RecordedExchange) key() string {
+	return s.Method + " " + s.Path + "?" + s.Query
+}
+
+func (s RecordedExchange) pathKey() string {
+	return s.Method + " " + normalizePath(s.Path)
+}
+
+func redactValues(values url.Values) url.Values {
+	redacted := CopyURLValues(values)
+	for key := range redacted {
+		if isSensitiveField(key) {
+			redacted[key] = []string{redactedValue}
+		}
+	}
+
+	return redacted
+}
+
+func redactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	redacted := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if len(redacted.Values(name)) > 0 {
+			redacted.Set(name, redactedValue)
+		}
+	}
+
+	return redacted
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range typed {
+			if isSensitiveField(key) {
+				typed[key] = redactedValue
+			} else {
+				typed[key] = redactJSON(nested)
+			}
+		}
+
+	case []interface{}:
+		for idx, nested := range typed {
+			typed[idx] = redactJSON(nested)
+		}
+
+	case string:
+		return redactText(typed)
+	}
+
+	return value
+}
+
+func redactText(text string) string {
+	return sensitiveAssignment.ReplaceAllString(text, "$1="+redactedValue)
+}
+
+// redactBody replaces credentials in form encoded, JSON and text bodies.
+// Bodies of any other type are recorded as they are.
+func redactBody(header http.Header, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	contentType := header.Get("Content-Type")
+
+	switch {
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return []byte(redactValues(values).Encode())
+		}
+
+	case strings.Contains(contentType, "json"):
+		var document interface{}
+		if err := json.Unmarshal(body, &document); err == nil {
+			if redacted, err := json.Marshal(redactJSON(document)); err == nil {
+				return redacted
+			}
+		}
+
+	case strings.HasPrefix(contentType, "text/"):
+		return []byte(redactText(string(body)))
+	}
+
+	return body
+}
+
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// RecordingTransport passes requests to the wrapped transport and appends every
+// exchange to a file, one JSON document per line. The file is only open while
+// an exchange is written to it so that the transport needs no closing.
+type RecordingTransport struct {
+	next http.RoundTripper
+	path string
+	lock *sync.Mutex
+}
+
+func openRecording(path string) (*os.File, error) {
+	if output, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return nil, fmt.Errorf("failed to open recording %s: %w", path, err)
+	} else {
+		return output, nil
+	}
+}
+
+func NewRecordingTransport(next http.RoundTripper, path string) (*RecordingTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if output, err := openRecording(path); err != nil {
+		return nil, err
+	} else {
+		output.Close()
+	}
+
+	return &RecordingTransport{
+		next: next,
+		path: path,
+		lock: &sync.Mutex{},
+	}, nil
+}
+
+func (s *RecordingTransport) record(exchange RecordedExchange) error {
+	encoded, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	output, err := openRecording(s.path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := output.Write(append(encoded, '\n')); err != nil {
+		output.Close()
+		return err
+	}
+
+	return output.Close()
+}
+
+func (s *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body has been consumed so the request is sent with a copy
+	forwarded := req.Clone(req.Context())
+	if requestBody != nil {
+		forwarded.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	exchange := RecordedExchange{
+		RecordedAt:    time.Now(),
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		Query:         redactValues(req.URL.Query()).Encode(),
+		RequestHeader: redactHeader(req.Header),
+		RequestBody:   redactBody(req.Header, requestBody),
+	}
+
+	resp, err := s.next.RoundTrip(forwarded)
+	if err != nil {
+		exchange.TransportFailed = err.Error()
+
+		if recordErr := s.record(exchange); recordErr != nil {
+			return nil, fmt.Errorf("%v (recording failed: %v)", err, recordErr)
+		}
+
+		return nil, err
+	}
+
+	exchange.StatusCode = resp.StatusCode
+	exchange.ResponseHeader = redactHeader(resp.Header)
+
+	if !isRecordedContent(resp.Header) {
+		exchange.ResponseStreamed = true
+	} else {
+		responseBody, err := readBody(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+		exchange.ResponseBody = redactBody(resp.Header, responseBody)
+	}
+
+	if err := s.record(exchange); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to record exchange for %s: %w", req.URL.Path, err)
+	}
+
+	return resp, nil
+}
+
+// ReplayTransport serves the exchanges of a recording without touching the
+// network. Requests are matched by method, path and query, falling back to
+// method and path, with path filter values ignored, for requests that embed
+// the time of the original session. Matching exchanges are served in recorded
+// order and the last one repeats once they run out so that polling loops keep
+// working. Streamed responses were not recorded and replay with an empty body.
+type ReplayTransport struct {
+	exchanges     map[string][]RecordedExchange
+	pathExchanges map[string][]RecordedExchange
+	served        map[string]int
+	lock          *sync.Mutex
+}
+
+func LoadRecording(path string) ([]RecordedExchange, error) {
+	input, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording %s: %w", path, err)
+	}
+
+	defer input.Close()
+
+	var (
+		exchanges []RecordedExchange
+		reader    = bufio.NewReader(input)
+	)
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var exchange RecordedExchange
+			if err := json.Unmarshal(line, &exchange); err != nil {
+				return nil, fmt.Errorf("recording %s line %d is malformed: %w", path, lineNumber, err)
+			}
+
+			exchanges = append(exchanges, exchange)
+		}
+
+		if err == io.EOF {
+			return exchanges, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read recording %s: %w", path, err)
+		}
+	}
+}
+
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	exchanges, err := LoadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &ReplayTransport{
+		exchanges:     make(map[string][]RecordedExchange),
+		pathExchanges: make(map[string][]RecordedExchange),
+		served:        make(map[string]int),
+		lock:          &sync.Mutex{},
+	}
+
+	for _, exchange := range exchanges {
+		transport.exchanges[exchange.key()] = append(transport.exchanges[exchange.key()], exchange)
+		transport.pathExchanges[exchange.pathKey()] = append(transport.pathExchanges[exchange.pathKey()], exchange)
+	}
+
+	return transport, nil
+}
+
+func (s *ReplayTransport) next(key string, candidates []RecordedExchange) RecordedExchange {
+	idx := s.served[key]
+	if idx >= len(candidates) {
+		return candidates[len(candidates)-1]
+	}
+
+	s.served[key] = idx + 1
+	return candidates[idx]
+}
+
+func (s *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	lookup := RecordedExchange{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  redactValues(req.URL.Query()).Encode(),
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var exchange RecordedExchange
+	if candidates, found := s.exchanges[lookup.key()]; found {
+		exchange = s.next(lookup.key(), candidates)
+	} else if candidates, found := s.pathExchanges[lookup.pathKey()]; found {
+		exchange = s.next(lookup.pathKey(), candidates)
+	} else {
+		return nil, fmt.Errorf("no recorded exchange for %s %s", req.Method, req.URL.Path)
+	}
+
+	if len(exchange.TransportFailed) > 0 {
+		return nil, fmt.Errorf("replayed transport failure: %s", exchange.TransportFailed)
+	}
+
+	header := http.Header{}
+	if exchange.ResponseHeader != nil {
+		header = exchange.ResponseHeader.Clone()
+	}
+
+	// Redaction may have changed the length of the recorded body and streamed
+	// bodies were not recorded at all
+	header.Del("Content-Length")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.StatusCode, http.StatusText(exchange.StatusCode)),
+		StatusCode:    exchange.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(exchange.ResponseBody)),
+		ContentLength: int64(len(exchange.ResponseBody)),
+		Request:       req,
+	}, nil
+}
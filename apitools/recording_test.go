@@ -0,0 +1,201 @@
+package apitools
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "pass=secret&user=admin&stateful=1",
+			expected:    "pass=REDACTED&stateful=1&user=REDACTED",
+		},
+		{
+			name:        "json",
+			contentType: "application/json; charset=UTF-8",
+			body:        `{"access_token":"abc","version":"1.34","nested":[{"Token":"def"}]}`,
+			expected:    `{"access_token":"REDACTED","nested":[{"Token":"REDACTED"}],"version":"1.34"}`,
+		},
+		{
+			name:        "json string with credentials",
+			contentType: "application/json",
+			body:        `{"url":"/zm/cgi-bin/nph-zms?monitor=1&token=abc"}`,
+			expected:    `{"url":"/zm/cgi-bin/nph-zms?monitor=1\u0026token=REDACTED"}`,
+		},
+		{
+			name:        "html",
+			contentType: "text/html; charset=utf-8",
+			body:        `<img src="/zm/cgi-bin/nph-zms?mode=jpeg&auth=abc123&user=admin">`,
+			expected:    `<img src="/zm/cgi-bin/nph-zms?mode=jpeg&auth=REDACTED&user=REDACTED">`,
+		},
+		{
+			name:        "plain text without credentials",
+			contentType: "text/plain",
+			body:        "authentication required",
+			expected:    "authentication required",
+		},
+		{
+			name:        "binary",
+			contentType: "image/jpeg",
+			body:        "auth=abc",
+			expected:    "auth=abc",
+		},
+	}
+
+	for _, testCase := range cases {
+		header := http.Header{}
+		header.Set("Content-Type", testCase.contentType)
+
+		if redacted := string(redactBody(header, []byte(testCase.body))); redacted != testCase.expected {
+			t.Errorf("%s: expected %s but got %s", testCase.name, testCase.expected, redacted)
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{
+			path:     "/zm/api/events/index/StartTime >=:2024-01-01 00:00:00/EndTime <=:2024-01-02 00:00:00.json",
+			expected: "/zm/api/events/index/StartTime >=:/EndTime <=:.json",
+		},
+		{
+			path:     "/zm/api/events/index/Id >:123.json",
+			expected: "/zm/api/events/index/Id >:.json",
+		},
+		{
+			path:     "/zm/api/monitors.json",
+			expected: "/zm/api/monitors.json",
+		},
+	}
+
+	for _, testCase := range cases {
+		if normalized := normalizePath(testCase.path); normalized != testCase.expected {
+			t.Errorf("expected %s to normalize to %s but got %s", testCase.path, testCase.expected, normalized)
+		}
+	}
+}
+
+func get(t *testing.T, client *http.Client, target string) (*http.Response, string) {
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("request for %s failed: %v", target, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response for %s: %v", target, err)
+	}
+
+	return resp, string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	const (
+		eventsBody = `{"events":[{"Event":{"Id":"7"}}],"token":"secret"}`
+		videoBody  = "not really an mp4"
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/zm/api/events/index/"):
+			writer.Header().Set("Content-Type", "application/json")
+			writer.Write([]byte(eventsBody))
+
+		case req.URL.Path == "/zm/index.php":
+			writer.Header().Set("Content-Type", "video/mp4")
+			writer.Write([]byte(videoBody))
+
+		default:
+			http.NotFound(writer, req)
+		}
+	}))
+
+	defer server.Close()
+
+	recordingDir, err := ioutil.TempDir("", "recording")
+	if err != nil {
+		t.Fatalf("failed to create recording directory: %v", err)
+	}
+
+	defer os.RemoveAll(recordingDir)
+
+	recordingPath := filepath.Join(recordingDir, "session.jsonl")
+
+	recorder, err := NewRecordingTransport(nil, recordingPath)
+	if err != nil {
+		t.Fatalf("failed to create recording transport: %v", err)
+	}
+
+	var (
+		recordingClient = &http.Client{Transport: recorder}
+		recordedFilter  = "/zm/api/events/index/" + url.PathEscape("StartTime >=:2024-01-01 00:00:00.json")
+		replayedFilter  = "/zm/api/events/index/" + url.PathEscape("StartTime >=:2024-06-01 12:00:00.json")
+	)
+
+	if _, body := get(t, recordingClient, server.URL+recordedFilter+"?token=abc"); body != eventsBody {
+		t.Fatalf("recording altered the response body: %s", body)
+	}
+
+	if _, body := get(t, recordingClient, server.URL+"/zm/index.php?view=view_video&eid=7"); body != videoBody {
+		t.Fatalf("recording altered the streamed response body: %s", body)
+	}
+
+	exchanges, err := LoadRecording(recordingPath)
+	if err != nil {
+		t.Fatalf("failed to load recording: %v", err)
+	} else if len(exchanges) != 2 {
+		t.Fatalf("expected 2 recorded exchanges but found %d", len(exchanges))
+	}
+
+	if exchanges[0].Query != "token=REDACTED" {
+		t.Errorf("expected the query to be redacted but recorded %s", exchanges[0].Query)
+	} else if strings.Contains(string(exchanges[0].ResponseBody), "secret") {
+		t.Errorf("expected the response body to be redacted but recorded %s", exchanges[0].ResponseBody)
+	}
+
+	if !exchanges[1].ResponseStreamed || len(exchanges[1].ResponseBody) > 0 {
+		t.Errorf("expected the video response to be streamed without being recorded")
+	}
+
+	replayer, err := NewReplayTransport(recordingPath)
+	if err != nil {
+		t.Fatalf("failed to create replay transport: %v", err)
+	}
+
+	replayClient := &http.Client{Transport: replayer}
+
+	if resp, body := get(t, replayClient, "http://zoneminder.invalid"+replayedFilter+"?token=xyz"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the path filter to replay with status 200 but got %d", resp.StatusCode)
+	} else if body != string(exchanges[0].ResponseBody) {
+		t.Errorf("expected the recorded events to replay but got %s", body)
+	}
+
+	if resp, body := get(t, replayClient, "http://zoneminder.invalid/zm/index.php?view=view_video&eid=7"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the streamed response to replay with status 200 but got %d", resp.StatusCode)
+	} else if len(body) > 0 {
+		t.Errorf("expected the streamed response to replay without a body but got %s", body)
+	}
+
+	if _, err := replayClient.Get("http://zoneminder.invalid/zm/api/monitors.json"); err == nil {
+		t.Errorf("expected a request that was never recorded to fail")
+	}
+}
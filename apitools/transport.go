@@ -0,0 +1,164 @@
+package apitools
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultDialTimeout         = time.Second * 30
+	defaultKeepAlive           = time.Second * 30
+	defaultTLSHandshakeTimeout = time.Second * 10
+	defaultIdleConnTimeout     = time.Second * 90
+	defaultMaxIdleConns        = 100
+)
+
+type TransportOptions struct {
+	CACertFile         string
+	ClientCertFile     string
+	ClientKeyFile      string
+	InsecureSkipVerify bool
+
+	// ProxyURL supports the http, https and socks5 schemes. When empty the
+	// standard proxy environment variables are honored.
+	ProxyURL string
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	RequestTimeout        time.Duration
+
+	// RecordPath names a file that every request and response is appended to
+	// with credentials redacted. ReplayPath serves a previous recording back
+	// instead of contacting the server. At most one of them may be set.
+	RecordPath string
+	ReplayPath string
+}
+
+func newTLSConfig(options TransportOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if len(options.CACertFile) > 0 {
+		if pemCerts, err := ioutil.ReadFile(options.CACertFile); err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %w", options.CACertFile, err)
+		} else {
+			certPool, err := x509.SystemCertPool()
+			if err != nil || certPool == nil {
+				certPool = x509.NewCertPool()
+			}
+
+			if !certPool.AppendCertsFromPEM(pemCerts) {
+				return nil, fmt.Errorf("no certificates found in CA bundle %s", options.CACertFile)
+			}
+
+			tlsConfig.RootCAs = certPool
+		}
+	}
+
+	if len(options.ClientCertFile) > 0 || len(options.ClientKeyFile) > 0 {
+		if clientCert, err := tls.LoadX509KeyPair(options.ClientCertFile, options.ClientKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %w", options.ClientCertFile, err)
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{clientCert}
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func durationOrDefault(value, defaultValue time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+
+	return defaultValue
+}
+
+func NewHTTPTransport(options TransportOptions) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   durationOrDefault(options.DialTimeout, defaultDialTimeout),
+			KeepAlive: defaultKeepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   options.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       options.MaxConnsPerHost,
+		IdleConnTimeout:       durationOrDefault(options.IdleConnTimeout, defaultIdleConnTimeout),
+		TLSHandshakeTimeout:   durationOrDefault(options.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: options.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	if options.MaxIdleConns > 0 {
+		transport.MaxIdleConns = options.MaxIdleConns
+	}
+
+	if len(options.ProxyURL) > 0 {
+		if proxyURL, err := url.Parse(options.ProxyURL); err != nil {
+			return nil, fmt.Errorf("malformed proxy URL %s: %w", options.ProxyURL, err)
+		} else {
+			switch proxyURL.Scheme {
+			case "http", "https", "socks5":
+				transport.Proxy = http.ProxyURL(proxyURL)
+
+			default:
+				return nil, fmt.Errorf("unsupported proxy scheme %s", proxyURL.Scheme)
+			}
+		}
+	}
+
+	if tlsConfig, err := newTLSConfig(options); err != nil {
+		return nil, err
+	} else {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+func newRoundTripper(options TransportOptions) (http.RoundTripper, error) {
+	if len(options.RecordPath) > 0 && len(options.ReplayPath) > 0 {
+		return nil, fmt.Errorf("a transport can not both record and replay")
+	}
+
+	if len(options.ReplayPath) > 0 {
+		return NewReplayTransport(options.ReplayPath)
+	}
+
+	transport, err := NewHTTPTransport(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.RecordPath) > 0 {
+		return NewRecordingTransport(transport, options.RecordPath)
+	}
+
+	return transport, nil
+}
+
+func NewHTTPClient(options TransportOptions) (*http.Client, error) {
+	if transport, err := newRoundTripper(options); err != nil {
+		return nil, err
+	} else {
+		return &http.Client{
+			Transport: transport,
+			Timeout:   options.RequestTimeout,
+		}, nil
+	}
+}
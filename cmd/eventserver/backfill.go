@@ -0,0 +1,369 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zinic/forculus/cmd"
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/eventserver/actors"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+	"github.com/zinic/forculus/zoneminder/constants"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+const (
+	backfillUploaded = "uploaded"
+	backfillSkipped  = "skipped"
+	backfillFiltered = "filtered"
+	backfillFailed   = "failed"
+)
+
+type backfillOptions struct {
+	rawFrom     string
+	rawTo       string
+	servers     []string
+	monitors    []string
+	uploaders   []string
+	concurrency int
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func parseBackfillTime(raw string, location *time.Location) (time.Time, error) {
+	if parsed, err := time.ParseInLocation(constants.ZMDateFormat, raw, location); err == nil {
+		return parsed, nil
+	}
+
+	return time.Parse(time.RFC3339, raw)
+}
+
+// window resolves the backfill window for a server. Times without a zone are
+// read in the server's timezone, like the event timestamps they select.
+func (s backfillOptions) window(location *time.Location) (time.Time, time.Time, error) {
+	var (
+		from, to = time.Time{}, time.Now()
+		err      error
+	)
+
+	if from, err = parseBackfillTime(s.rawFrom, location); err != nil {
+		return from, to, fmt.Errorf("malformed start time %s: %w", s.rawFrom, err)
+	}
+
+	if len(s.rawTo) > 0 {
+		if to, err = parseBackfillTime(s.rawTo, location); err != nil {
+			return from, to, fmt.Errorf("malformed end time %s: %w", s.rawTo, err)
+		}
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("the backfill start time must be before its end time")
+	}
+
+	return from, to, nil
+}
+
+type backfillProgress struct {
+	total  int
+	done   int
+	counts map[string]int
+	lock   *sync.Mutex
+}
+
+func (s *backfillProgress) report(monitorEvent zmapi.MonitorEvent, results []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.done += 1
+	for _, result := range results {
+		s.counts[result] += 1
+	}
+
+	fmt.Printf("[%d/%d] event %s on %s: %s\n", s.done, s.total, monitorEvent.Name, monitorEvent.Server, strings.Join(results, ", "))
+}
+
+// Backfill feeds historical events through the selected uploaders only
+type Backfill struct {
+	opts          backfillOptions
+	clients       map[string]zmapi.Client
+	uploaders     map[string]*actors.EventUploader
+	recordKeepers map[string]*actors.RecordKeeper
+}
+
+func (s *Backfill) listEvents() ([]zmapi.MonitorEvent, error) {
+	var monitorEvents []zmapi.MonitorEvent
+
+	for serverName, client := range s.clients {
+		from, to, err := s.opts.window(client.TimeZone())
+		if err != nil {
+			return nil, fmt.Errorf("backfill window for %s: %w", serverName, err)
+		}
+
+		if len(s.opts.monitors) == 0 {
+			if serverEvents, err := client.ListEventsBetween(from, to); err != nil {
+				return nil, fmt.Errorf("failed to list events from %s: %w", serverName, err)
+			} else {
+				monitorEvents = append(monitorEvents, serverEvents...)
+			}
+
+			continue
+		}
+
+		for _, monitorID := range s.opts.monitors {
+			if monitorEventList, err := client.ListMonitorEvents(monitorID, from, to); err != nil {
+				return nil, fmt.Errorf("failed to list events for monitor %s from %s: %w", monitorID, serverName, err)
+			} else {
+				monitorEvents = append(monitorEvents, monitorEventList...)
+			}
+		}
+	}
+
+	return monitorEvents, nil
+}
+
+// recorded reports whether any record keeper already holds the event for the
+// uploader's storage target. Records written before record keepers indexed
+// their source are not found that way, so the storage key is checked as well.
+func (s *Backfill) recorded(uploader *actors.EventUploader, monitorEvent zmapi.MonitorEvent) (bool, error) {
+	for recordKeeperName, recordKeeper := range s.recordKeepers {
+		if recorded, err := recordKeeper.Recorded(uploader.StorageTarget(), monitorEvent); err != nil {
+			return false, fmt.Errorf("record keeper %s: %w", recordKeeperName, err)
+		} else if recorded {
+			return true, nil
+		}
+	}
+
+	if stored, err := uploader.Stored(monitorEvent); err != nil {
+		return false, fmt.Errorf("storage target %s: %w", uploader.StorageTarget(), err)
+	} else {
+		return stored, nil
+	}
+}
+
+func (s *Backfill) process(monitorEvent zmapi.MonitorEvent) []string {
+	var results []string
+
+	for _, uploaderName := range s.opts.uploaders {
+		uploader := s.uploaders[uploaderName]
+
+		if recorded, err := s.recorded(uploader, monitorEvent); err != nil {
+			log.Errorf("Failed to check for existing records of event %s: %v", monitorEvent.Name, err)
+			results = append(results, fmt.Sprintf("%s %s", uploaderName, backfillFailed))
+		} else if recorded {
+			results = append(results, fmt.Sprintf("%s %s", uploaderName, backfillSkipped))
+		} else if payload, uploaded, err := uploader.Upload(monitorEvent); err != nil {
+			log.Errorf("Uploader %s: %v", uploaderName, err)
+			results = append(results, fmt.Sprintf("%s %s", uploaderName, backfillFailed))
+		} else if !uploaded {
+			results = append(results, fmt.Sprintf("%s %s", uploaderName, backfillFiltered))
+		} else {
+			for recordKeeperName, recordKeeper := range s.recordKeepers {
+				if _, err := recordKeeper.Record(payload); err != nil {
+					log.Errorf("Failed to record event %s with record keeper %s: %v", monitorEvent.Name, recordKeeperName, err)
+				}
+			}
+
+			results = append(results, fmt.Sprintf("%s %s", uploaderName, backfillUploaded))
+		}
+	}
+
+	return results
+}
+
+func (s *Backfill) Run() error {
+	monitorEvents, err := s.listEvents()
+	if err != nil {
+		return err
+	}
+
+	var (
+		eventC   = make(chan zmapi.MonitorEvent)
+		workers  = &sync.WaitGroup{}
+		progress = &backfillProgress{
+			counts: make(map[string]int),
+			lock:   &sync.Mutex{},
+		}
+	)
+
+	for _, monitorEvent := range monitorEvents {
+		if monitorEvent.Closed() {
+			progress.total += 1
+		}
+	}
+
+	fmt.Printf("Backfilling %d events\n", progress.total)
+
+	for worker := 0; worker < s.opts.concurrency; worker++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for monitorEvent := range eventC {
+				progress.report(monitorEvent, s.process(monitorEvent))
+			}
+		}()
+	}
+
+	for _, monitorEvent := range monitorEvents {
+		if !monitorEvent.Closed() {
+			log.Warnf("Skipping event %s on %s as it is still being recorded", monitorEvent.Name, monitorEvent.Server)
+			continue
+		}
+
+		eventC <- monitorEvent
+	}
+
+	close(eventC)
+	workers.Wait()
+
+	fmt.Printf("Backfill complete: %d uploaded, %d skipped, %d filtered, %d failed\n",
+		progress.counts[backfillUploaded],
+		progress.counts[backfillSkipped],
+		progress.counts[backfillFiltered],
+		progress.counts[backfillFailed])
+
+	if failed := progress.counts[backfillFailed]; failed > 0 {
+		return fmt.Errorf("%d uploads failed", failed)
+	}
+
+	return nil
+}
+
+func newBackfill(cfg config.EventServerConfig, opts backfillOptions, dispatch eventserver.EventDispatch) (*Backfill, error) {
+	zmCfgs := cfg.Zoneminders
+	if len(opts.servers) > 0 {
+		zmCfgs = make(map[string]config.Zoneminder, len(opts.servers))
+
+		for _, serverName := range opts.servers {
+			if zmCfg, exists := cfg.Zoneminders[serverName]; !exists {
+				return nil, fmt.Errorf("unknown zoneminder server %s", serverName)
+			} else {
+				zmCfgs[serverName] = zmCfg
+			}
+		}
+	}
+
+	zmClients, err := cmd.NewZoneminderClients(zmCfgs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.CheckZoneminderCompatibility(zmClients); err != nil {
+		return nil, err
+	}
+
+	storageProviders, err := cmd.InitializeStorageProviders(cfg.StorageProviders)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		exporters = cmd.NewEventExporters(zmCfgs, zmClients)
+		backfill  = &Backfill{
+			opts:          opts,
+			clients:       zmClients,
+			uploaders:     make(map[string]*actors.EventUploader, len(opts.uploaders)),
+			recordKeepers: make(map[string]*actors.RecordKeeper, len(cfg.RecordKeepers)),
+		}
+	)
+
+	for _, uploaderName := range opts.uploaders {
+		if uploaderCfg, exists := cfg.Uploaders[uploaderName]; !exists {
+			return nil, fmt.Errorf("unknown uploader %s", uploaderName)
+		} else {
+			provider := storageProviders[uploaderCfg.StorageTarget]
+			backfill.uploaders[uploaderName] = actors.NewEventUploader(uploaderName, dispatch, exporters, provider, uploaderCfg)
+		}
+	}
+
+	for recordKeeperName, recordKeeperCfg := range cfg.RecordKeepers {
+		if recordKeeper, err := actors.NewEventRecordKeeper(dispatch, recordKeeperCfg); err != nil {
+			return nil, fmt.Errorf("failed to initialize record keeper %s: %w", recordKeeperName, err)
+		} else {
+			backfill.recordKeepers[recordKeeperName] = recordKeeper
+		}
+	}
+
+	return backfill, nil
+}
+
+func backfillMain(args []string) {
+	var (
+		cfgPath     string
+		enableInfo  bool
+		enableDebug bool
+		rawFrom     string
+		rawTo       string
+		rawServers  string
+		rawMonitors string
+		rawUpload   string
+		concurrency int
+	)
+
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	flags.StringVar(&cfgPath, "c", "", "Path to a valid configuration TOML file.")
+	flags.BoolVar(&enableInfo, "v", false, "Enable verbose output.")
+	flags.BoolVar(&enableDebug, "d", false, "Enable debug output. This switch supersedes verbose output.")
+	flags.StringVar(&rawFrom, "from", "", "Start of the backfill window as \"YYYY-MM-DD HH:MM:SS\" in the zoneminder server's timezone or RFC 3339.")
+	flags.StringVar(&rawTo, "to", "", "End of the backfill window. Defaults to now.")
+	flags.StringVar(&rawServers, "server", "", "Comma separated zoneminder servers to backfill from. Defaults to all servers.")
+	flags.StringVar(&rawMonitors, "monitor", "", "Comma separated monitor IDs to backfill. Defaults to all monitors.")
+	flags.StringVar(&rawUpload, "uploader", "", "Comma separated uploaders to feed events into.")
+	flags.IntVar(&concurrency, "concurrency", 2, "Number of events to process concurrently.")
+	flags.Parse(args)
+
+	log.ConfigureDefaults()
+
+	if cfgPath == "" {
+		log.Fatalf("Configuration path required.")
+	}
+
+	configureLogging(enableInfo, enableDebug)
+
+	opts := backfillOptions{
+		rawFrom:     rawFrom,
+		rawTo:       rawTo,
+		servers:     splitList(rawServers),
+		monitors:    splitList(rawMonitors),
+		uploaders:   splitList(rawUpload),
+		concurrency: concurrency,
+	}
+
+	// The window is resolved again for each server once its timezone is
+	// known; this only catches malformed times early
+	if len(rawFrom) == 0 {
+		log.Fatalf("A backfill start time is required.")
+	} else if _, _, err := opts.window(time.Local); err != nil {
+		log.Fatalf("Error: %v", err)
+	} else if len(opts.uploaders) == 0 {
+		log.Fatalf("At least one uploader is required.")
+	} else if opts.concurrency < 1 {
+		log.Fatalf("Concurrency must be at least 1.")
+	}
+
+	serviceManager := service.NewManager()
+	defer serviceManager.Stop()
+
+	if cfg, err := config.LoadEventServerCfg(cfgPath); err != nil {
+		log.Fatalf("configuration error: %v", err)
+	} else if backfill, err := newBackfill(cfg, opts, eventserver.NewDispatch(serviceManager)); err != nil {
+		log.Fatalf("Error: %v", err)
+	} else if err := backfill.Run(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"time"
 
 	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/eventserver/inbound"
 	"github.com/zinic/forculus/eventserver/services"
+	"github.com/zinic/forculus/eventserver/statedb"
 
 	"github.com/zinic/forculus/cmd"
 	"github.com/zinic/forculus/config"
@@ -13,36 +18,130 @@ import (
 	"github.com/zinic/forculus/service"
 )
 
+// subscriptionOptions builds the options of a handler subscription, making it
+// durable through the journal when its queue asks for it
+func subscriptionOptions(queue config.Queue, name string, state config.State, journal *statedb.Journal) (eventserver.SubscriptionOptions, error) {
+	options, err := queue.Options(name, state.SpillPath)
+	if err != nil {
+		return options, err
+	}
+
+	if queue.Durable {
+		if journal == nil {
+			return options, fmt.Errorf("durable queues require a state database")
+		}
+
+		options.Journal = journal
+	}
+
+	return options, nil
+}
+
 func start(cfg config.EventServerConfig) error {
+	zmClients, err := cmd.NewZoneminderClients(cfg.Zoneminders)
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.CheckZoneminderCompatibility(zmClients); err != nil {
+		return err
+	}
+
+	restartPolicy, err := cfg.Supervisor.Policy()
+	if err != nil {
+		return err
+	}
+
+	const seenEventsTTL = time.Hour
+
 	var (
-		zmClient       = cmd.NewZoneminderClient(cfg.Zoneminder)
-		serviceManager = service.NewManager()
-		reactor        = eventserver.NewDispatch(serviceManager)
-		monitorWatch   = services.NewMonitorWatch(zmClient, reactor)
+		serviceManager   = service.NewManagerWithPolicy(restartPolicy)
+		reactor          = eventserver.NewDispatch(serviceManager)
+		runStateControls = make(map[string]*services.RunStateControl, len(zmClients))
+		finalizers       = make(map[string]*services.EventFinalizer, len(zmClients))
+		cadences         = make(map[string]*services.PollCadence, len(zmClients))
+		stateDB          *statedb.Database
+		journal          *statedb.Journal
+		seenEvents       *services.SeenEvents
 	)
 
+	if cfg.State.Persistent() {
+		maxCatchUp, err := cfg.State.MaxCatchUpDuration()
+		if err != nil {
+			return err
+		}
+
+		if stateDB, err = statedb.NewDatabase(cfg.State.DatabasePath); err != nil {
+			return err
+		}
+
+		defer stateDB.Close()
+
+		if retention, err := cfg.State.JournalRetentionDuration(); err != nil {
+			return err
+		} else {
+			journal = statedb.NewJournal(stateDB, retention)
+			defer journal.Close()
+		}
+
+		seenEvents = services.NewPersistentSeenEvents(seenEventsTTL, stateDB, maxCatchUp+seenEventsTTL)
+		actors.RegisterCheckpointRecorder(reactor, stateDB)
+	} else {
+		seenEvents = services.NewSeenEvents(seenEventsTTL)
+	}
+
 	if log.Thresholds().Accepts(log.LevelDebug) {
 		actors.RegisterEventLogger(reactor)
 	}
 
-	actors.RegisterMonitorEventWatch(reactor, zmClient)
+	for zmName, zmClient := range zmClients {
+		cadence, err := services.NewPollCadence(zmName, cfg.Zoneminders[zmName].Polling)
+		if err != nil {
+			return err
+		}
+
+		cadences[zmName] = cadence
+		finalizers[zmName] = services.NewEventFinalizer(zmClient, reactor, seenEvents, cfg.Zoneminders[zmName].Finalize)
+		actors.RegisterMonitorEventWatch(reactor, zmClient, finalizers[zmName], cadence)
+		runStateControls[zmName] = services.NewRunStateControl(zmClient, reactor)
+
+		log.Debugf("New zoneminder server %s registered", zmName)
+	}
+
+	// Snapshots are only grabbed when an alert will send them
+	for _, alertCfg := range cfg.EmailAlerts {
+		if alertCfg.Filter.EventTrigger == eventserver.MonitorAlertSnapshot {
+			actors.RegisterAlertSnapshotter(reactor, zmClients)
+			break
+		}
+	}
 
 	for alertName, alertCfg := range cfg.EmailAlerts {
-		actors.RegisterEventEmailSender(reactor, alertName, alertCfg, cfg.SMTPServers[alertCfg.Server])
+		if options, err := subscriptionOptions(alertCfg.Queue, "email_alert."+alertName, cfg.State, journal); err != nil {
+			return fmt.Errorf("email alert %s has a malformed queue configuration: %w", alertName, err)
+		} else if err := actors.RegisterEventEmailSender(reactor, alertName, alertCfg, cfg.SMTPServers[alertCfg.Server], options); err != nil {
+			return fmt.Errorf("failed to register email alert %s: %w", alertName, err)
+		}
 
 		log.Debugf("New email alert %s registered to send to SMTP server %s", alertName, alertCfg.Server)
 	}
 
+	exporters := cmd.NewEventExporters(cfg.Zoneminders, zmClients)
+
 	if storageProviders, err := cmd.InitializeStorageProviders(cfg.StorageProviders); err != nil {
 		log.Fatalf("Failed to initialize storage providers: %v", err)
 	} else {
 		for uploaderName, uploaderCfg := range cfg.Uploaders {
 			var (
 				provider = storageProviders[uploaderCfg.StorageTarget]
-				uploader = actors.NewUploader(uploaderName, reactor, zmClient, provider, uploaderCfg)
+				uploader = actors.NewUploader(uploaderName, reactor, exporters, provider, uploaderCfg)
 			)
 
-			reactor.Register(uploader, eventserver.MonitorNewEvent)
+			if options, err := subscriptionOptions(uploaderCfg.Queue, "uploader."+uploaderName, cfg.State, journal); err != nil {
+				return fmt.Errorf("uploader %s has a malformed queue configuration: %w", uploaderName, err)
+			} else if _, err := reactor.RegisterWithOptions(uploader, options, eventserver.MonitorNewEvent); err != nil {
+				return fmt.Errorf("failed to register uploader %s: %w", uploaderName, err)
+			}
 
 			log.Debugf("New uploader %s registered to upload to storage provider %s", uploaderName, uploaderCfg.StorageTarget)
 		}
@@ -50,12 +149,61 @@ func start(cfg config.EventServerConfig) error {
 	}
 
 	for recordKeeperName, recordKeeperCfg := range cfg.RecordKeepers {
-		reactor.Register(actors.NewRecordKeeper(reactor, recordKeeperCfg), eventserver.MonitorEventUploaded)
+		if recordKeeper, err := actors.NewRecordKeeper(reactor, recordKeeperCfg); err != nil {
+			log.Fatalf("Failed to initialize record keeper %s: %v", recordKeeperName, err)
+		} else if options, err := subscriptionOptions(recordKeeperCfg.Queue, "record_keeper."+recordKeeperName, cfg.State, journal); err != nil {
+			return fmt.Errorf("record keeper %s has a malformed queue configuration: %w", recordKeeperName, err)
+		} else if _, err := reactor.RegisterWithOptions(recordKeeper, options, eventserver.MonitorEventUploaded); err != nil {
+			return fmt.Errorf("failed to register record keeper %s: %w", recordKeeperName, err)
+		}
 
 		log.Debugf("New record keeper %s registered", recordKeeperName)
 	}
 
-	serviceManager.Start(monitorWatch)
+	reactor.Replay()
+
+	for zmName, zmClient := range zmClients {
+		zmCfg := cfg.Zoneminders[zmName]
+
+		if err := services.CatchUp(zmClient, finalizers[zmName], seenEvents, stateDB, cfg.State, zmCfg.Finalize); err != nil {
+			return fmt.Errorf("failed to catch up on events from %s: %w", zmName, err)
+		}
+	}
+
+	for zmName, zmClient := range zmClients {
+		var (
+			inventoryCfg = cfg.Zoneminders[zmName].Inventory
+			inventory    = services.NewMonitorInventory(zmClient, reactor, inventoryCfg)
+		)
+
+		serviceManager.Start(inventory)
+		serviceManager.Start(services.NewMonitorWatch(zmClient, inventory, cadences[zmName], reactor, inventoryCfg))
+		serviceManager.Start(finalizers[zmName])
+
+		if healthCfg := cfg.Zoneminders[zmName].Health; healthCfg.Enabled {
+			serviceManager.Start(services.NewHostHealthWatch(zmClient, reactor, healthCfg))
+		}
+
+		if eventTailCfg := cfg.Zoneminders[zmName].EventTail; eventTailCfg.Enabled {
+			serviceManager.Start(services.NewEventTail(zmClient, finalizers[zmName], eventTailCfg))
+		}
+
+		if logTailCfg := cfg.Zoneminders[zmName].LogTail; logTailCfg.Enabled {
+			if logTail, err := services.NewLogTail(zmClient, reactor, logTailCfg); err != nil {
+				return err
+			} else {
+				serviceManager.Start(logTail)
+			}
+		}
+	}
+
+	if len(cfg.RunStateSchedules) > 0 {
+		serviceManager.Start(services.NewRunStateSchedule(runStateControls, cfg.RunStateSchedules))
+	}
+
+	if cfg.Inbound.BindAddress != "" {
+		serviceManager.Start(inbound.NewServer(cfg.Inbound, inbound.NewHandler(runStateControls, cadences, reactor)))
+	}
 
 	cmd.WaitForSignal()
 
@@ -66,7 +214,24 @@ func start(cfg config.EventServerConfig) error {
 	return nil
 }
 
+func configureLogging(enableInfo, enableDebug bool) {
+	log.Configure()
+
+	if enableInfo {
+		log.AddOutput(log.NewStdoutLogger(log.LevelInfo, ""))
+	} else if enableDebug {
+		log.AddOutput(log.NewStdoutLogger(log.LevelDebug, ""))
+	} else {
+		log.AddOutput(log.NewStdoutLogger(log.LevelWarn, ""))
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		backfillMain(os.Args[2:])
+		return
+	}
+
 	var (
 		cfgPath     string
 		validateCfg bool
@@ -88,15 +253,7 @@ func main() {
 	}
 
 	// Configure log output
-	log.Configure()
-
-	if enableInfo {
-		log.AddOutput(log.NewStdoutLogger(log.LevelInfo, ""))
-	} else if enableDebug {
-		log.AddOutput(log.NewStdoutLogger(log.LevelDebug, ""))
-	} else {
-		log.AddOutput(log.NewStdoutLogger(log.LevelWarn, ""))
-	}
+	configureLogging(enableInfo, enableDebug)
 
 	// Load configuration and either output that it's valid or start the daemon
 	if cfg, err := config.LoadEventServerCfg(cfgPath); err != nil {
@@ -10,7 +10,7 @@ import (
 )
 
 func main() {
-	eventRecord := rkdb.EventRecord{
+	eventRecord := rkdb.CreateEventRecord{
 		StorageTarget: "aws_s3",
 		StorageKey:    "event-12345.tar.gz",
 		AccessToken:   "access_token",
@@ -26,10 +26,10 @@ func main() {
 
 	endpoint := apitools.NewEndpoint("http", "localhost", 8080, "")
 
-	client := rkapi.NewClient(credentials, endpoint)
-	if newRecord, err := client.CreateEventRecord(eventRecord); err != nil {
+	client := rkapi.NewClient(credentials, endpoint, nil)
+	if newRecordID, err := client.CreateEventRecord(eventRecord); err != nil {
 		fmt.Printf("Error: %s\n", err)
 	} else {
-		fmt.Printf("New record created - ID:%d\n", newRecord.ID)
+		fmt.Printf("New record created - ID:%d\n", newRecordID)
 	}
 }
@@ -29,20 +29,28 @@ func main() {
 	// Load configuration and either output that it's valid or start the daemon
 	if cfg, err := config.LoadEventServerCfg(cfgPath); err != nil {
 		log.Fatalf("configuration error: %v", err)
+	} else if clients, err := cmd.NewZoneminderClients(cfg.Zoneminders); err != nil {
+		log.Fatalf("Error: %v", err)
 	} else {
-		client := cmd.NewZoneminderClient(cfg.Zoneminder)
-
-		if err := client.Login(); err != nil {
-			log.Fatalf("Error logging in: %v", err)
+		for name, client := range clients {
+			if err := client.Login(); err != nil {
+				log.Fatalf("Error logging in to %s: %v", name, err)
+			}
+
+			session := client.LoginSession()
+			nextRefresh := session.LastRefresh.Add(time.Second * time.Duration(session.Details.AccessTokenExpires))
+			nextLogin := session.Created.Add(time.Second * time.Duration(session.Details.RefreshTokenExpires))
+
+			log.Infof("Login session for %s using auth mode %s", name, client.AuthMode())
+			log.Infof("   Last refresh %s", session.LastRefresh)
+			log.Infof("   Next refresh %s", nextRefresh)
+			log.Infof("   Next login   %s", nextLogin)
+
+			if report, err := client.CheckCompatibility(); err != nil {
+				log.Errorf("%v", err)
+			} else {
+				log.Info(report.String())
+			}
 		}
-
-		session := client.LoginSession()
-		nextRefresh := session.LastRefresh.Add(time.Second * time.Duration(session.Details.AccessTokenExpires))
-		nextLogin := session.Created.Add(time.Second * time.Duration(session.Details.RefreshTokenExpires))
-
-		log.Infof("Login session")
-		log.Infof("   Last refresh %s", session.LastRefresh)
-		log.Infof("   Next refresh %s", nextRefresh)
-		log.Infof("   Next login   %s", nextLogin)
 	}
 }
@@ -15,6 +15,7 @@ import (
 
 	"github.com/zinic/forculus/config"
 	"github.com/zinic/forculus/zoneminder/zmapi"
+	"github.com/zinic/forculus/zoneminder/zmfs"
 )
 
 func InitializeStorageProviders(storageProviderCfgs map[string]config.StorageProvider) (map[string]storage.Provider, error) {
@@ -32,7 +33,22 @@ func InitializeStorageProviders(storageProviderCfgs map[string]config.StoragePro
 	return storageProviders, nil
 }
 
-func NewZoneminderClient(cfg config.Zoneminder) zmapi.Client {
+func NewZoneminderClient(name string, cfg config.Zoneminder) (zmapi.Client, error) {
+	authMode, err := zmapi.ParseAuthMode(cfg.AuthMode)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := cfg.Transport.NewHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+
 	var (
 		endpoint = apitools.NewEndpoint(
 			cfg.Scheme,
@@ -41,12 +57,61 @@ func NewZoneminderClient(cfg config.Zoneminder) zmapi.Client {
 			cfg.RootPath)
 
 		credentials = zmapi.LoginCredentials{
+			Mode:     authMode,
 			Username: cfg.Username,
 			Password: cfg.Password,
+			APIKey:   cfg.APIKey,
 		}
 	)
 
-	return zmapi.NewClient(endpoint, credentials)
+	return zmapi.NewClient(name, endpoint, httpClient, credentials, location), nil
+}
+
+func NewZoneminderClients(cfgs map[string]config.Zoneminder) (map[string]zmapi.Client, error) {
+	clients := make(map[string]zmapi.Client, len(cfgs))
+	for name, cfg := range cfgs {
+		if client, err := NewZoneminderClient(name, cfg); err != nil {
+			return nil, fmt.Errorf("failed initializing zoneminder client %s: %w", name, err)
+		} else {
+			clients[name] = client
+		}
+	}
+
+	return clients, nil
+}
+
+// NewEventExporters selects how events are retrieved from each Zoneminder
+// server, reading directly from disk for servers with local ingestion enabled
+func NewEventExporters(cfgs map[string]config.Zoneminder, clients map[string]zmapi.Client) map[string]zmapi.EventExporter {
+	exporters := make(map[string]zmapi.EventExporter, len(clients))
+	for name, client := range clients {
+		if localCfg := cfgs[name].Local; localCfg.Enabled {
+			exporters[name] = zmfs.NewExporter(client, localCfg.EventsPath, localCfg.StoragePaths)
+			log.Debugf("Zoneminder server %s events will be read from the local filesystem", name)
+		} else {
+			exporters[name] = client
+		}
+	}
+
+	return exporters
+}
+
+// CheckZoneminderCompatibility verifies that every configured Zoneminder server
+// runs a supported release, logging a compatibility report for each server
+func CheckZoneminderCompatibility(clients map[string]zmapi.Client) error {
+	for name, client := range clients {
+		if report, err := client.CheckCompatibility(); err != nil {
+			if incompatibleErr, isIncompatible := err.(zmapi.IncompatibleServerError); isIncompatible {
+				log.Error(incompatibleErr.Report.String())
+			}
+
+			return fmt.Errorf("zoneminder server %s failed compatibility checks: %w", name, err)
+		} else {
+			log.Info(report.String())
+		}
+	}
+
+	return nil
 }
 
 func WaitForSignal() {
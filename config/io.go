@@ -12,13 +12,47 @@ func LoadEventServerCfg(path string) (EventServerConfig, error) {
 
 	if absPath, err := filepath.Abs(path); err != nil {
 		return EventServerConfig{}, fmt.Errorf("failed to resolve %s to an absolute path: %v\n", path, err)
-	} else if _, err := toml.DecodeFile(absPath, &cfg); err != nil {
+	} else if md, err := toml.DecodeFile(absPath, &cfg); err != nil {
+		return EventServerConfig{}, err
+	} else if zoneminders, err := decodeZoneminders(md, cfg.Zoneminder); err != nil {
 		return EventServerConfig{}, err
+	} else {
+		cfg.Zoneminders = zoneminders
 	}
 
 	return parseEventServerCfg(cfg)
 }
 
+// decodeZoneminders supports both a single legacy [zoneminder] block, which is
+// registered under DefaultZoneminderName, and any number of named
+// [zoneminder.*] sections.
+func decodeZoneminders(md toml.MetaData, primitive toml.Primitive) (map[string]Zoneminder, error) {
+	if !md.IsDefined("zoneminder") {
+		return nil, nil
+	}
+
+	if md.IsDefined("zoneminder", "host") {
+		var zoneminder Zoneminder
+
+		if err := md.PrimitiveDecode(primitive, &zoneminder); err != nil {
+			return nil, err
+		}
+
+		zoneminder.Legacy = true
+
+		return map[string]Zoneminder{
+			DefaultZoneminderName: zoneminder,
+		}, nil
+	}
+
+	zoneminders := make(map[string]Zoneminder)
+	if err := md.PrimitiveDecode(primitive, &zoneminders); err != nil {
+		return nil, err
+	}
+
+	return zoneminders, nil
+}
+
 func LoadRecordKeeperCfg(path string) (RecordKeeperConfig, error) {
 	cfg := RecordKeeperConfig{}
 
@@ -1,30 +1,90 @@
 package config
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/zoneminder/zmapi"
 )
 
 type StorageProviderType string
 
 const (
 	ProviderAWS StorageProviderType = "aws_s3"
+
+	DefaultZoneminderName = "default"
 )
 
 type EventServerConfig struct {
-	Zoneminder       Zoneminder
-	StorageProviders map[string]StorageProvider
-	Uploaders        map[string]Uploader
-	RecordKeepers    map[string]RecordKeeperClient
-	SMTPServers      map[string]SMTPServer
-	EmailAlerts      map[string]EmailAlert
+	Zoneminders       map[string]Zoneminder
+	StorageProviders  map[string]StorageProvider
+	Uploaders         map[string]Uploader
+	RecordKeepers     map[string]RecordKeeperClient
+	SMTPServers       map[string]SMTPServer
+	EmailAlerts       map[string]EmailAlert
+	Inbound           Inbound
+	RunStateSchedules map[string]RunStateSchedule
+	State             State
+	Supervisor        Supervisor
+}
+
+type RunStateSchedule struct {
+	Server    string
+	State     string
+	TimeOfDay time.Duration
+	Days      map[time.Weekday]struct{}
+}
+
+func (s RunStateSchedule) ActiveOn(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+
+	_, active := s.Days[day]
+	return active
+}
+
+func (s RunStateSchedule) NextAfter(after time.Time) time.Time {
+	var (
+		year, month, day = after.Date()
+		hour             = int(s.TimeOfDay / time.Hour)
+		minute           = int((s.TimeOfDay % time.Hour) / time.Minute)
+		timeOfDay        = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	)
+
+	for offset := 0; offset <= 7; offset++ {
+		// The wall clock time is built directly so that the schedule still
+		// fires at the configured time on days with a DST transition
+		candidate := time.Date(year, month, day+offset, hour, minute, 0, 0, after.Location())
+
+		// A wall clock time skipped by the transition resolves to the offset
+		// from before it, which is the gap too early; fire right after the gap
+		if wall := time.Duration(candidate.Hour())*time.Hour + time.Duration(candidate.Minute())*time.Minute; wall != timeOfDay {
+			candidate = candidate.Add((timeOfDay - wall + 24*time.Hour) % (24 * time.Hour))
+		}
+
+		if candidate.After(after) && s.ActiveOn(candidate.Weekday()) {
+			return candidate
+		}
+	}
+
+	return time.Time{}
 }
 
 type Uploader struct {
 	StorageTarget string
 	Filter        AlertFilter
+	VideoOnly     bool
+	Export        zmapi.ExportOptions
+	Queue         Queue
+
+	// ServerPrefix places uploads below a directory named after the
+	// Zoneminder server. Legacy single server configurations keep the
+	// unprefixed key layout of existing buckets.
+	ServerPrefix bool
 }
 
 type EmailAlert struct {
@@ -35,7 +95,317 @@ type EmailAlert struct {
 type AlertFilter struct {
 	EventTrigger        eventserver.EventType
 	NameRegex           *regexp.Regexp
+	Servers             map[string]struct{}
+	Groups              map[string]struct{}
+	IncludeZones        map[string]struct{}
+	ExcludeZones        map[string]struct{}
 	AlertFrameThreshold int
 	EventTimeAfter      time.Time
 	EventTimeBefore     time.Time
 }
+
+// AcceptsGroups reports whether a monitor in the given groups matches the
+// filter. Any one configured group is enough.
+func (s AlertFilter) AcceptsGroups(groups []string) bool {
+	if len(s.Groups) == 0 {
+		return true
+	}
+
+	for _, group := range groups {
+		if _, accepted := s.Groups[group]; accepted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AcceptsZones checks the zones that triggered an event. With include zones set
+// at least one triggering zone must be included. With exclude zones set the
+// event is rejected when every triggering zone is excluded, so an event that
+// also crossed a zone of interest still passes.
+func (s AlertFilter) AcceptsZones(zones []string) bool {
+	if len(s.IncludeZones) > 0 {
+		included := false
+		for _, zone := range zones {
+			if _, isIncluded := s.IncludeZones[zone]; isIncluded {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			return false
+		}
+	}
+
+	if len(s.ExcludeZones) > 0 && len(zones) > 0 {
+		for _, zone := range zones {
+			if _, isExcluded := s.ExcludeZones[zone]; !isExcluded {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (s AlertFilter) AcceptsServer(server string) bool {
+	if len(s.Servers) == 0 {
+		return true
+	}
+
+	_, accepted := s.Servers[server]
+	return accepted
+}
+
+const (
+	defaultStateMaxCatchUp       = time.Hour * 24
+	defaultStateJournalRetention = time.Hour * 24 * 7
+
+	defaultEventTailPollInterval = time.Second * 5
+
+	defaultLogTailPollInterval = time.Second * 30
+	defaultLogTailMaxPages     = 5
+	defaultLogPatternCooldown  = time.Minute * 10
+
+	defaultPollingFastInterval  = time.Second * 2
+	defaultPollingIdleInterval  = time.Second * 5
+	defaultPollingAlarmCooldown = time.Minute * 2
+	defaultPollingMaxInterval   = time.Minute
+	defaultPollingSlowScan      = time.Second * 2
+
+	defaultInventoryRefreshInterval = time.Minute
+	defaultInventoryAlarmWorkers    = 8
+
+	defaultFinalizePollInterval = time.Second * 2
+	defaultFinalizeMaxWait      = time.Minute * 10
+	defaultFinalizeStablePolls  = 1
+
+	defaultHealthPollInterval    = time.Second * 30
+	defaultHealthDiskHighPercent = 90
+	defaultHealthStalledPolls    = 3
+)
+
+// parseInterval parses the interval of a poller, which must be positive since
+// tickers can not run on a zero or negative interval
+func parseInterval(raw string) (time.Duration, error) {
+	if interval, err := time.ParseDuration(raw); err != nil {
+		return 0, err
+	} else if interval <= 0 {
+		return 0, fmt.Errorf("interval %s must be positive", raw)
+	} else {
+		return interval, nil
+	}
+}
+
+func (s Health) PollDuration() (time.Duration, error) {
+	if len(s.PollInterval) == 0 {
+		return defaultHealthPollInterval, nil
+	}
+
+	return parseInterval(s.PollInterval)
+}
+
+func (s Health) DiskThreshold() float64 {
+	if s.DiskHighPercent <= 0 {
+		return defaultHealthDiskHighPercent
+	}
+
+	return s.DiskHighPercent
+}
+
+func (s Health) StalledThreshold() int {
+	if s.StalledPolls <= 0 {
+		return defaultHealthStalledPolls
+	}
+
+	return s.StalledPolls
+}
+
+const (
+	TimeZoneAuto  = "auto"
+	TimeZoneLocal = "local"
+)
+
+// Location resolves the configured timezone of the Zoneminder server. A nil
+// location means the timezone should be detected from the server.
+func (s Zoneminder) Location() (*time.Location, error) {
+	switch s.TimeZone {
+	case "", TimeZoneAuto:
+		return nil, nil
+
+	case TimeZoneLocal:
+		return time.Local, nil
+
+	default:
+		return time.LoadLocation(s.TimeZone)
+	}
+}
+
+// Persistent reports whether watcher state should be kept in a local database
+func (s State) Persistent() bool {
+	return len(s.DatabasePath) > 0
+}
+
+func (s State) MaxCatchUpDuration() (time.Duration, error) {
+	if len(s.MaxCatchUp) == 0 {
+		return defaultStateMaxCatchUp, nil
+	}
+
+	return time.ParseDuration(s.MaxCatchUp)
+}
+
+// JournalRetentionDuration is how long unacknowledged events are kept for
+// durable queues
+func (s State) JournalRetentionDuration() (time.Duration, error) {
+	return parseDurationOrDefault(s.JournalRetention, defaultStateJournalRetention)
+}
+
+func parseDurationOrDefault(raw string, defaultDuration time.Duration) (time.Duration, error) {
+	if len(raw) == 0 {
+		return defaultDuration, nil
+	}
+
+	return time.ParseDuration(raw)
+}
+
+func parseIntervalOrDefault(raw string, defaultDuration time.Duration) (time.Duration, error) {
+	if len(raw) == 0 {
+		return defaultDuration, nil
+	}
+
+	return parseInterval(raw)
+}
+
+// FastDuration is the polling interval while a monitor is or was recently
+// alarmed
+func (s Polling) FastDuration() (time.Duration, error) {
+	return parseIntervalOrDefault(s.FastInterval, defaultPollingFastInterval)
+}
+
+// IdleDuration is the polling interval while every monitor is idle
+func (s Polling) IdleDuration() (time.Duration, error) {
+	return parseIntervalOrDefault(s.IdleInterval, defaultPollingIdleInterval)
+}
+
+// CooldownDuration is how long polling stays fast after the last alarm
+func (s Polling) CooldownDuration() (time.Duration, error) {
+	if cooldown, err := parseDurationOrDefault(s.AlarmCooldown, defaultPollingAlarmCooldown); err != nil {
+		return 0, err
+	} else if cooldown < 0 {
+		return 0, fmt.Errorf("alarm cooldown %s must not be negative", s.AlarmCooldown)
+	} else {
+		return cooldown, nil
+	}
+}
+
+// MaxDuration caps the polling interval when backing off from a slow server
+func (s Polling) MaxDuration() (time.Duration, error) {
+	return parseIntervalOrDefault(s.MaxInterval, defaultPollingMaxInterval)
+}
+
+// SlowScanDuration is the scan time above which polling backs off
+func (s Polling) SlowScanDuration() (time.Duration, error) {
+	return parseIntervalOrDefault(s.SlowScan, defaultPollingSlowScan)
+}
+
+func (s Inventory) RefreshDuration() (time.Duration, error) {
+	if len(s.RefreshInterval) == 0 {
+		return defaultInventoryRefreshInterval, nil
+	}
+
+	return parseInterval(s.RefreshInterval)
+}
+
+func (s Inventory) Workers() int {
+	if s.AlarmWorkers <= 0 {
+		return defaultInventoryAlarmWorkers
+	}
+
+	return s.AlarmWorkers
+}
+
+func (s EventTail) PollDuration() (time.Duration, error) {
+	if len(s.PollInterval) == 0 {
+		return defaultEventTailPollInterval, nil
+	}
+
+	return parseInterval(s.PollInterval)
+}
+
+func (s LogTail) PollDuration() (time.Duration, error) {
+	return parseIntervalOrDefault(s.PollInterval, defaultLogTailPollInterval)
+}
+
+// PageLimit caps how many pages of logs are read in a single poll so that a
+// burst of log output cannot stall the tail
+func (s LogTail) PageLimit() int {
+	if s.MaxPages <= 0 {
+		return defaultLogTailMaxPages
+	}
+
+	return s.MaxPages
+}
+
+func (s LogPattern) Regex() (*regexp.Regexp, error) {
+	if len(s.Match) == 0 {
+		return nil, fmt.Errorf("no match expression set")
+	}
+
+	return regexp.Compile(s.Match)
+}
+
+// CooldownDuration is how long further matches of the pattern on the same
+// component are suppressed after one has been dispatched
+func (s LogPattern) CooldownDuration() (time.Duration, error) {
+	return parseDurationOrDefault(s.Cooldown, defaultLogPatternCooldown)
+}
+
+// AcceptsLevel reports whether a log line with the given level code, such as
+// ERR or WAR, is of interest to the pattern
+func (s LogPattern) AcceptsLevel(code string) bool {
+	if len(s.Levels) == 0 {
+		return true
+	}
+
+	for _, level := range s.Levels {
+		if strings.EqualFold(level, code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AcceptsComponent matches the component that wrote a log line by prefix so
+// that "zmc" covers the capture daemon of every monitor
+func (s LogPattern) AcceptsComponent(component string) bool {
+	return strings.HasPrefix(component, s.Component)
+}
+
+func (s Finalize) PollDuration() (time.Duration, error) {
+	if len(s.PollInterval) == 0 {
+		return defaultFinalizePollInterval, nil
+	}
+
+	return parseInterval(s.PollInterval)
+}
+
+func (s Finalize) MaxWaitDuration() (time.Duration, error) {
+	if len(s.MaxWait) == 0 {
+		return defaultFinalizeMaxWait, nil
+	}
+
+	return time.ParseDuration(s.MaxWait)
+}
+
+func (s Finalize) StableThreshold() int {
+	if s.StablePolls <= 0 {
+		return defaultFinalizeStablePolls
+	}
+
+	return s.StablePolls
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunStateScheduleNextAfterDST(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		timeOfDay time.Duration
+		days      map[time.Weekday]struct{}
+		after     time.Time
+		expected  time.Time
+		elapsed   time.Duration
+	}{
+		{
+			name:      "spring forward",
+			timeOfDay: 7*time.Hour + 30*time.Minute,
+			after:     time.Date(2024, time.March, 9, 8, 0, 0, 0, location),
+			expected:  time.Date(2024, time.March, 10, 7, 30, 0, 0, location),
+			elapsed:   22*time.Hour + 30*time.Minute,
+		},
+		{
+			name:      "fall back",
+			timeOfDay: 7*time.Hour + 30*time.Minute,
+			after:     time.Date(2024, time.November, 2, 8, 0, 0, 0, location),
+			expected:  time.Date(2024, time.November, 3, 7, 30, 0, 0, location),
+			elapsed:   24*time.Hour + 30*time.Minute,
+		},
+		{
+			name:      "restricted to the transition day",
+			timeOfDay: 7*time.Hour + 30*time.Minute,
+			days:      map[time.Weekday]struct{}{time.Sunday: {}},
+			after:     time.Date(2024, time.March, 6, 12, 0, 0, 0, location),
+			expected:  time.Date(2024, time.March, 10, 7, 30, 0, 0, location),
+			elapsed:   3*24*time.Hour + 19*time.Hour + 30*time.Minute - time.Hour,
+		},
+		{
+			name:      "skipped wall clock time",
+			timeOfDay: 2*time.Hour + 30*time.Minute,
+			after:     time.Date(2024, time.March, 10, 1, 0, 0, 0, location),
+			expected:  time.Date(2024, time.March, 10, 3, 30, 0, 0, location),
+			elapsed:   90 * time.Minute,
+		},
+	}
+
+	for _, testCase := range cases {
+		schedule := RunStateSchedule{
+			TimeOfDay: testCase.timeOfDay,
+			Days:      testCase.days,
+		}
+
+		if next := schedule.NextAfter(testCase.after); !next.Equal(testCase.expected) {
+			t.Errorf("%s: expected %v but got %v", testCase.name, testCase.expected, next)
+		} else if elapsed := next.Sub(testCase.after); elapsed != testCase.elapsed {
+			t.Errorf("%s: expected the schedule to fire after %v but it fires after %v", testCase.name, testCase.elapsed, elapsed)
+		}
+	}
+}
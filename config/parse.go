@@ -3,12 +3,47 @@ package config
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/zoneminder/zmapi"
 )
 
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
 func parseAlertFilterFields(cfg alertFilter) (AlertFilter, error) {
 	filter := AlertFilter{
 		EventTrigger:        cfg.EventTrigger,
 		AlertFrameThreshold: cfg.AlertFrameThreshold,
+		Servers:             make(map[string]struct{}, len(cfg.Servers)),
+		Groups:              make(map[string]struct{}, len(cfg.Groups)),
+		IncludeZones:        make(map[string]struct{}, len(cfg.IncludeZones)),
+		ExcludeZones:        make(map[string]struct{}, len(cfg.ExcludeZones)),
+	}
+
+	for _, server := range cfg.Servers {
+		filter.Servers[server] = struct{}{}
+	}
+
+	for _, group := range cfg.Groups {
+		filter.Groups[group] = struct{}{}
+	}
+
+	for _, zone := range cfg.IncludeZones {
+		filter.IncludeZones[zone] = struct{}{}
+	}
+
+	for _, zone := range cfg.ExcludeZones {
+		filter.ExcludeZones[zone] = struct{}{}
 	}
 
 	if len(cfg.NameFilterRegex) > 0 {
@@ -22,15 +57,55 @@ func parseAlertFilterFields(cfg alertFilter) (AlertFilter, error) {
 	return filter, nil
 }
 
+func setOptionalFlag(target *bool, value *bool) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+func parseExportOptions(cfg export) (zmapi.ExportOptions, error) {
+	options := zmapi.DefaultExportOptions()
+
+	setOptionalFlag(&options.Detail, cfg.Detail)
+	setOptionalFlag(&options.Frames, cfg.Frames)
+	setOptionalFlag(&options.Images, cfg.Images)
+	setOptionalFlag(&options.Video, cfg.Video)
+	setOptionalFlag(&options.Misc, cfg.Misc)
+	setOptionalFlag(&options.Compress, cfg.Compress)
+
+	if format, err := zmapi.ParseExportFormat(cfg.Format); err != nil {
+		return options, err
+	} else {
+		options.Format = format
+	}
+
+	if !options.Detail && !options.Frames && !options.Images && !options.Video && !options.Misc {
+		return options, fmt.Errorf("export must include at least one of detail, frames, images, video or misc")
+	}
+
+	return options, nil
+}
+
+func isLegacyZoneminder(zoneminders map[string]Zoneminder) bool {
+	zoneminder, found := zoneminders[DefaultZoneminderName]
+	return found && zoneminder.Legacy
+}
+
 func compileUploaders(cfg eventServerConfiguration) (map[string]Uploader, error) {
 	uploaders := make(map[string]Uploader, len(cfg.Uploaders))
 	for name, rawUploader := range cfg.Uploaders {
 		if filter, err := parseAlertFilterFields(rawUploader.Filter); err != nil {
 			return nil, fmt.Errorf("uploader %s has a malformed configuration: %w", name, err)
+		} else if exportOptions, err := parseExportOptions(rawUploader.Export); err != nil {
+			return nil, fmt.Errorf("uploader %s has a malformed export configuration: %w", name, err)
 		} else {
 			uploaders[name] = Uploader{
 				StorageTarget: rawUploader.StorageTarget,
 				Filter:        filter,
+				VideoOnly:     rawUploader.Export.VideoOnly,
+				Export:        exportOptions,
+				Queue:         rawUploader.Queue,
+				ServerPrefix:  !isLegacyZoneminder(cfg.Zoneminders),
 			}
 		}
 	}
@@ -54,6 +129,55 @@ func compileEmailAlerts(cfg eventServerConfiguration) (map[string]EmailAlert, er
 	return alerts, nil
 }
 
+func parseWeekday(raw string) (time.Weekday, error) {
+	if normalized := strings.ToLower(strings.TrimSpace(raw)); len(normalized) >= 3 {
+		if weekday, found := weekdays[normalized[:3]]; found {
+			return weekday, nil
+		}
+	}
+
+	return time.Sunday, fmt.Errorf("unknown day of the week %s", raw)
+}
+
+func compileRunStateSchedules(cfg eventServerConfiguration) (map[string]RunStateSchedule, error) {
+	schedules := make(map[string]RunStateSchedule, len(cfg.RunStateSchedules))
+	for name, rawSchedule := range cfg.RunStateSchedules {
+		schedule := RunStateSchedule{
+			Server: rawSchedule.Server,
+			State:  rawSchedule.State,
+			Days:   make(map[time.Weekday]struct{}, len(rawSchedule.Days)),
+		}
+
+		if len(rawSchedule.State) == 0 {
+			return nil, fmt.Errorf("run state schedule %s does not specify a state", name)
+		}
+
+		if len(schedule.Server) == 0 && len(cfg.Zoneminders) == 1 {
+			for serverName := range cfg.Zoneminders {
+				schedule.Server = serverName
+			}
+		}
+
+		if timeOfDay, err := time.Parse("15:04", rawSchedule.At); err != nil {
+			return nil, fmt.Errorf("run state schedule %s has a malformed time %s: %w", name, rawSchedule.At, err)
+		} else {
+			schedule.TimeOfDay = time.Duration(timeOfDay.Hour())*time.Hour + time.Duration(timeOfDay.Minute())*time.Minute
+		}
+
+		for _, rawDay := range rawSchedule.Days {
+			if weekday, err := parseWeekday(rawDay); err != nil {
+				return nil, fmt.Errorf("run state schedule %s has a malformed configuration: %w", name, err)
+			} else {
+				schedule.Days[weekday] = struct{}{}
+			}
+		}
+
+		schedules[name] = schedule
+	}
+
+	return schedules, nil
+}
+
 func validateStorageProviderReferences(cfg EventServerConfig) error {
 	for uploaderName, uploaderCfg := range cfg.Uploaders {
 		if _, providerExists := cfg.StorageProviders[uploaderCfg.StorageTarget]; !providerExists {
@@ -64,6 +188,158 @@ func validateStorageProviderReferences(cfg EventServerConfig) error {
 	return nil
 }
 
+func validatePolling(cfg Polling) error {
+	if fast, err := cfg.FastDuration(); err != nil {
+		return fmt.Errorf("malformed fast interval: %w", err)
+	} else if idle, err := cfg.IdleDuration(); err != nil {
+		return fmt.Errorf("malformed idle interval: %w", err)
+	} else if max, err := cfg.MaxDuration(); err != nil {
+		return fmt.Errorf("malformed max interval: %w", err)
+	} else if _, err := cfg.CooldownDuration(); err != nil {
+		return fmt.Errorf("malformed alarm cooldown: %w", err)
+	} else if _, err := cfg.SlowScanDuration(); err != nil {
+		return fmt.Errorf("malformed slow scan threshold: %w", err)
+	} else if fast > idle {
+		return fmt.Errorf("fast_interval %s must not be longer than idle_interval %s", fast, idle)
+	} else if max < idle {
+		return fmt.Errorf("max_interval %s must not be shorter than fast_interval %s or idle_interval %s", max, fast, idle)
+	}
+
+	return nil
+}
+
+func validateLogTail(cfg LogTail) error {
+	if _, err := cfg.PollDuration(); err != nil {
+		return fmt.Errorf("malformed poll interval: %w", err)
+	}
+
+	for name, pattern := range cfg.Patterns {
+		if _, err := pattern.Regex(); err != nil {
+			return fmt.Errorf("pattern %s has a malformed match expression: %w", name, err)
+		} else if _, err := pattern.CooldownDuration(); err != nil {
+			return fmt.Errorf("pattern %s has a malformed cooldown: %w", name, err)
+		}
+	}
+
+	if cfg.Enabled && len(cfg.Patterns) == 0 {
+		return fmt.Errorf("log tail is enabled but has no patterns")
+	}
+
+	return nil
+}
+
+func validateZoneminders(cfg EventServerConfig) error {
+	if len(cfg.Zoneminders) == 0 {
+		return fmt.Errorf("at least one zoneminder server must be configured")
+	}
+
+	for name, zoneminderCfg := range cfg.Zoneminders {
+		if authMode, err := zmapi.ParseAuthMode(zoneminderCfg.AuthMode); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed configuration: %w", name, err)
+		} else if authMode == zmapi.AuthModeAPIKey && len(zoneminderCfg.APIKey) == 0 {
+			return fmt.Errorf("zoneminder server %s uses auth mode %s but has no api_key set", name, authMode)
+		} else if _, err := zoneminderCfg.Location(); err != nil {
+			return fmt.Errorf("zoneminder server %s has an unknown timezone: %w", name, err)
+		} else if _, err := zoneminderCfg.Transport.Options(); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed transport configuration: %w", name, err)
+		} else if _, err := zoneminderCfg.Health.PollDuration(); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed health poll interval: %w", name, err)
+		} else if err := validatePolling(zoneminderCfg.Polling); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed polling configuration: %w", name, err)
+		} else if _, err := zoneminderCfg.Inventory.RefreshDuration(); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed inventory refresh interval: %w", name, err)
+		} else if _, err := zoneminderCfg.EventTail.PollDuration(); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed event tail poll interval: %w", name, err)
+		} else if err := validateLogTail(zoneminderCfg.LogTail); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed log tail configuration: %w", name, err)
+		} else if _, err := zoneminderCfg.Finalize.PollDuration(); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed finalize poll interval: %w", name, err)
+		} else if _, err := zoneminderCfg.Finalize.MaxWaitDuration(); err != nil {
+			return fmt.Errorf("zoneminder server %s has a malformed finalize max wait: %w", name, err)
+		}
+	}
+
+	for uploaderName, uploaderCfg := range cfg.Uploaders {
+		for server := range uploaderCfg.Filter.Servers {
+			if _, serverExists := cfg.Zoneminders[server]; !serverExists {
+				return fmt.Errorf("uploader %s references an unknown zoneminder server %s", uploaderName, server)
+			}
+		}
+	}
+
+	for alertName, alertCfg := range cfg.EmailAlerts {
+		for server := range alertCfg.Filter.Servers {
+			if _, serverExists := cfg.Zoneminders[server]; !serverExists {
+				return fmt.Errorf("email alert %s references an unknown zoneminder server %s", alertName, server)
+			}
+		}
+	}
+
+	for scheduleName, scheduleCfg := range cfg.RunStateSchedules {
+		if _, serverExists := cfg.Zoneminders[scheduleCfg.Server]; !serverExists {
+			return fmt.Errorf("run state schedule %s references an unknown zoneminder server %s", scheduleName, scheduleCfg.Server)
+		}
+	}
+
+	return nil
+}
+
+func validateRecordKeepers(cfg EventServerConfig) error {
+	for name, recordKeeperCfg := range cfg.RecordKeepers {
+		if _, err := recordKeeperCfg.Transport.Options(); err != nil {
+			return fmt.Errorf("record keeper %s has a malformed transport configuration: %w", name, err)
+		} else if err := validateQueue(recordKeeperCfg.Queue, name, cfg.State); err != nil {
+			return fmt.Errorf("record keeper %s has a malformed queue configuration: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateQueue(queue Queue, name string, state State) error {
+	if options, err := queue.Options(name, state.SpillPath); err != nil {
+		return err
+	} else if queue.Durable && !state.Persistent() {
+		return fmt.Errorf("durable queues require db_path to be set in the state configuration")
+	} else if queue.Durable && options.Policy != eventserver.Block && options.Policy != eventserver.Spill {
+		return fmt.Errorf("durable queues must use the block or spill policy since dropped events are not replayed")
+	}
+
+	return nil
+}
+
+func validateQueues(cfg EventServerConfig) error {
+	for name, uploaderCfg := range cfg.Uploaders {
+		if err := validateQueue(uploaderCfg.Queue, name, cfg.State); err != nil {
+			return fmt.Errorf("uploader %s has a malformed queue configuration: %w", name, err)
+		}
+	}
+
+	for name, alertCfg := range cfg.EmailAlerts {
+		if err := validateQueue(alertCfg.Queue, name, cfg.State); err != nil {
+			return fmt.Errorf("email alert %s has a malformed queue configuration: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateInbound(cfg Inbound) error {
+	if cfg.BindAddress == "" {
+		return nil
+	} else if len(cfg.Users) == 0 {
+		return fmt.Errorf("the inbound API requires at least one user when bind_address is set")
+	}
+
+	for username, authCfg := range cfg.Users {
+		if authCfg.Password == "" {
+			return fmt.Errorf("inbound API user %s must have a password", username)
+		}
+	}
+
+	return nil
+}
+
 func validateEmailAlertSMTPReferences(cfg EventServerConfig) error {
 	for alertName, alertCfg := range cfg.EmailAlerts {
 		if _, serverExists := cfg.SMTPServers[alertCfg.Server]; !serverExists {
@@ -76,10 +352,13 @@ func validateEmailAlertSMTPReferences(cfg EventServerConfig) error {
 
 func parseEventServerCfg(cfg eventServerConfiguration) (EventServerConfig, error) {
 	compiledCfg := EventServerConfig{
-		Zoneminder:       cfg.Zoneminder,
+		Zoneminders:      cfg.Zoneminders,
 		StorageProviders: cfg.StorageProviders,
 		SMTPServers:      cfg.SMTPServers,
 		RecordKeepers:    cfg.RecordKeepers,
+		Inbound:          cfg.Inbound,
+		State:            cfg.State,
+		Supervisor:       cfg.Supervisor,
 	}
 
 	if compiledUploaders, err := compileUploaders(cfg); err != nil {
@@ -94,6 +373,12 @@ func parseEventServerCfg(cfg eventServerConfiguration) (EventServerConfig, error
 		compiledCfg.EmailAlerts = compiledAlerts
 	}
 
+	if compiledSchedules, err := compileRunStateSchedules(cfg); err != nil {
+		return compiledCfg, err
+	} else {
+		compiledCfg.RunStateSchedules = compiledSchedules
+	}
+
 	if err := validateEmailAlertSMTPReferences(compiledCfg); err != nil {
 		return compiledCfg, err
 	}
@@ -102,5 +387,31 @@ func parseEventServerCfg(cfg eventServerConfiguration) (EventServerConfig, error
 		return compiledCfg, err
 	}
 
+	if err := validateInbound(compiledCfg.Inbound); err != nil {
+		return compiledCfg, err
+	}
+
+	if err := validateZoneminders(compiledCfg); err != nil {
+		return compiledCfg, err
+	}
+
+	if err := validateRecordKeepers(compiledCfg); err != nil {
+		return compiledCfg, err
+	}
+
+	if err := validateQueues(compiledCfg); err != nil {
+		return compiledCfg, err
+	}
+
+	if _, err := compiledCfg.State.MaxCatchUpDuration(); err != nil {
+		return compiledCfg, fmt.Errorf("state has a malformed max catch up window: %w", err)
+	} else if _, err := compiledCfg.State.JournalRetentionDuration(); err != nil {
+		return compiledCfg, fmt.Errorf("state has a malformed journal retention: %w", err)
+	}
+
+	if _, err := compiledCfg.Supervisor.Policy(); err != nil {
+		return compiledCfg, fmt.Errorf("supervisor has a malformed configuration: %w", err)
+	}
+
 	return compiledCfg, nil
 }
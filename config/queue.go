@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zinic/forculus/eventserver"
+)
+
+// Queue configures the buffer of the event subscription behind an uploader,
+// record keeper or email alert and what happens once that buffer is full
+type Queue struct {
+	BufferSize   int    `toml:"buffer_size"`
+	Policy       string `toml:"policy"`
+	BlockTimeout string `toml:"block_timeout"`
+
+	// Durable queues journal events in the state database until the handler
+	// is done with them so that they are delivered after a restart. They must
+	// use the block or spill policy.
+	Durable bool `toml:"durable"`
+}
+
+// Options builds the subscription options for the named handler. Spilled
+// events are kept below the given spill path.
+func (s Queue) Options(name, spillPath string) (eventserver.SubscriptionOptions, error) {
+	options := eventserver.SubscriptionOptions{
+		Name:       name,
+		BufferSize: s.BufferSize,
+		SpillPath:  spillPath,
+	}
+
+	if s.BufferSize < 0 {
+		return options, fmt.Errorf("buffer_size must not be negative")
+	}
+
+	if policy, err := eventserver.ParseBackpressurePolicy(s.Policy); err != nil {
+		return options, err
+	} else if options.BlockTimeout, err = parseOptionalDuration("block_timeout", s.BlockTimeout); err != nil {
+		return options, err
+	} else {
+		options.Policy = policy
+	}
+
+	if options.Policy == eventserver.Spill && len(spillPath) == 0 {
+		return options, fmt.Errorf("the spill policy requires spill_path to be set in the state configuration")
+	}
+
+	return options, nil
+}
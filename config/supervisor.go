@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/zinic/forculus/service"
+)
+
+// Supervisor configures how event handlers that panic or exit early are
+// restarted
+type Supervisor struct {
+	Strategy      string `toml:"strategy"`
+	MaxRestarts   int    `toml:"max_restarts"`
+	RestartWindow string `toml:"restart_window"`
+	MinBackoff    string `toml:"min_backoff"`
+	MaxBackoff    string `toml:"max_backoff"`
+}
+
+func (s Supervisor) Policy() (service.RestartPolicy, error) {
+	policy := service.RestartPolicy{
+		MaxRestarts: s.MaxRestarts,
+	}
+
+	if s.MaxRestarts < 0 {
+		return policy, fmt.Errorf("max_restarts must not be negative")
+	}
+
+	if strategy, err := service.ParseRestartStrategy(s.Strategy); err != nil {
+		return policy, err
+	} else if policy.Window, err = parseOptionalDuration("restart_window", s.RestartWindow); err != nil {
+		return policy, err
+	} else if policy.MinBackoff, err = parseOptionalDuration("min_backoff", s.MinBackoff); err != nil {
+		return policy, err
+	} else if policy.MaxBackoff, err = parseOptionalDuration("max_backoff", s.MaxBackoff); err != nil {
+		return policy, err
+	} else {
+		policy.Strategy = strategy
+	}
+
+	if policy.MinBackoff > 0 && policy.MaxBackoff > 0 && policy.MaxBackoff < policy.MinBackoff {
+		return policy, fmt.Errorf("max_backoff must not be shorter than min_backoff")
+	}
+
+	return policy, nil
+}
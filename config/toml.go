@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 
+	"github.com/BurntSushi/toml"
+
 	"github.com/zinic/forculus/eventserver"
 )
 
@@ -19,30 +21,123 @@ type AuthorizationConfig struct {
 }
 
 type eventServerConfiguration struct {
-	Zoneminder       Zoneminder                    `toml:"zoneminder"`
-	StorageProviders map[string]StorageProvider    `toml:"storage"`
-	RecordKeepers    map[string]RecordKeeperClient `toml:"record_keeper"`
-	Uploaders        map[string]uploader           `toml:"uploader"`
-	SMTPServers      map[string]SMTPServer         `toml:"smtp_server"`
-	EmailAlerts      map[string]emailAlert         `toml:"email_alert"`
-	Emailers         map[string]Emailer            `toml:"emailer"`
+	Zoneminder        toml.Primitive                `toml:"zoneminder"`
+	Zoneminders       map[string]Zoneminder         `toml:"-"`
+	StorageProviders  map[string]StorageProvider    `toml:"storage"`
+	RecordKeepers     map[string]RecordKeeperClient `toml:"record_keeper"`
+	Uploaders         map[string]uploader           `toml:"uploader"`
+	SMTPServers       map[string]SMTPServer         `toml:"smtp_server"`
+	EmailAlerts       map[string]emailAlert         `toml:"email_alert"`
+	Emailers          map[string]Emailer            `toml:"emailer"`
+	Inbound           Inbound                       `toml:"inbound"`
+	RunStateSchedules map[string]runStateSchedule   `toml:"run_state_schedule"`
+	State             State                         `toml:"state"`
+	Supervisor        Supervisor                    `toml:"supervisor"`
+}
+
+type State struct {
+	DatabasePath     string `toml:"db_path"`
+	MaxCatchUp       string `toml:"max_catch_up"`
+	SpillPath        string `toml:"spill_path"`
+	JournalRetention string `toml:"journal_retention"`
+}
+
+type Inbound struct {
+	BindAddress string                         `toml:"bind_address"`
+	Users       map[string]AuthorizationConfig `toml:"user"`
+}
+
+type runStateSchedule struct {
+	Server string   `toml:"server"`
+	State  string   `toml:"state"`
+	At     string   `toml:"at"`
+	Days   []string `toml:"days"`
 }
 
 type Zoneminder struct {
-	Scheme   string `toml:"scheme"`
-	Host     string `toml:"host"`
-	Port     int    `toml:"port"`
-	RootPath string `toml:"root_path"`
-	Username string `toml:"username"`
-	Password string `toml:"password"`
+	Scheme    string    `toml:"scheme"`
+	Host      string    `toml:"host"`
+	Port      int       `toml:"port"`
+	RootPath  string    `toml:"root_path"`
+	Username  string    `toml:"username"`
+	Password  string    `toml:"password"`
+	AuthMode  string    `toml:"auth_mode"`
+	APIKey    string    `toml:"api_key"`
+	TimeZone  string    `toml:"timezone"`
+	Transport Transport `toml:"transport"`
+	Health    Health    `toml:"health"`
+	Local     Local     `toml:"local"`
+	EventTail EventTail `toml:"event_tail"`
+	LogTail   LogTail   `toml:"log_tail"`
+	Inventory Inventory `toml:"inventory"`
+	Polling   Polling   `toml:"polling"`
+	Finalize  Finalize  `toml:"finalize"`
+
+	// Legacy is set for a server configured through a single unnamed
+	// [zoneminder] block
+	Legacy bool `toml:"-"`
+}
+
+type Finalize struct {
+	PollInterval string `toml:"poll_interval"`
+	MaxWait      string `toml:"max_wait"`
+	StablePolls  int    `toml:"stable_polls"`
+}
+
+type Polling struct {
+	FastInterval  string `toml:"fast_interval"`
+	IdleInterval  string `toml:"idle_interval"`
+	AlarmCooldown string `toml:"alarm_cooldown"`
+	MaxInterval   string `toml:"max_interval"`
+	SlowScan      string `toml:"slow_scan"`
+}
+
+type Inventory struct {
+	RefreshInterval string `toml:"refresh_interval"`
+	AlarmWorkers    int    `toml:"alarm_workers"`
+}
+
+type EventTail struct {
+	Enabled      bool   `toml:"enabled"`
+	PollInterval string `toml:"poll_interval"`
+}
+
+type LogTail struct {
+	Enabled      bool                  `toml:"enabled"`
+	PollInterval string                `toml:"poll_interval"`
+	MaxPages     int                   `toml:"max_pages"`
+	Patterns     map[string]LogPattern `toml:"pattern"`
+}
+
+type LogPattern struct {
+	Match     string   `toml:"match"`
+	Component string   `toml:"component"`
+	Levels    []string `toml:"levels"`
+	Cooldown  string   `toml:"cooldown"`
+}
+
+type Local struct {
+	Enabled      bool              `toml:"enabled"`
+	EventsPath   string            `toml:"events_path"`
+	StoragePaths map[string]string `toml:"storage_paths"`
+}
+
+type Health struct {
+	Enabled         bool    `toml:"enabled"`
+	PollInterval    string  `toml:"poll_interval"`
+	DiskHighPercent float64 `toml:"disk_high_percent"`
+	LoadHigh        float64 `toml:"load_high"`
+	StalledPolls    int     `toml:"stalled_polls"`
 }
 
 type RecordKeeperClient struct {
-	Scheme   string `toml:"scheme"`
-	Host     string `toml:"host"`
-	Port     int    `toml:"port"`
-	Username string `toml:"username"`
-	Password string `toml:"password"`
+	Scheme    string    `toml:"scheme"`
+	Host      string    `toml:"host"`
+	Port      int       `toml:"port"`
+	Username  string    `toml:"username"`
+	Password  string    `toml:"password"`
+	Transport Transport `toml:"transport"`
+	Queue     Queue     `toml:"queue"`
 }
 
 type SMTPServer struct {
@@ -61,6 +156,7 @@ func (s SMTPServer) FormatAddress() string {
 type StorageProvider struct {
 	Provider   StorageProviderType `toml:"provider"`
 	Properties map[string]string   `toml:"properties"`
+	Transport  Transport           `toml:"transport"`
 }
 
 type Emailer struct {
@@ -71,6 +167,19 @@ type Emailer struct {
 type uploader struct {
 	StorageTarget string      `toml:"storage_target"`
 	Filter        alertFilter `toml:"filter"`
+	Export        export      `toml:"export"`
+	Queue         Queue       `toml:"queue"`
+}
+
+type export struct {
+	VideoOnly bool   `toml:"video_only"`
+	Detail    *bool  `toml:"detail"`
+	Frames    *bool  `toml:"frames"`
+	Images    *bool  `toml:"images"`
+	Video     *bool  `toml:"video"`
+	Misc      *bool  `toml:"misc"`
+	Format    string `toml:"format"`
+	Compress  *bool  `toml:"compress"`
 }
 
 type emailAlert struct {
@@ -78,11 +187,16 @@ type emailAlert struct {
 	SubjectTemplate string      `toml:"subject_template"`
 	Recipients      []string    `toml:"recipients"`
 	Filter          alertFilter `toml:"filter"`
+	Queue           Queue       `toml:"queue"`
 }
 
 type alertFilter struct {
 	EventTrigger        eventserver.EventType `toml:"event_trigger"`
 	NameFilterRegex     string                `toml:"name_filter"`
+	Servers             []string              `toml:"servers"`
+	Groups              []string              `toml:"groups"`
+	IncludeZones        []string              `toml:"include_zones"`
+	ExcludeZones        []string              `toml:"exclude_zones"`
 	AlertFrameThreshold int                   `toml:"alert_frame_threshold"`
 	EventTimeAfter      string                `toml:"event_time_after"`
 	EventTimeBefore     string                `toml:"event_time_before"`
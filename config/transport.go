@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zinic/forculus/apitools"
+)
+
+type Transport struct {
+	CACertificate         string `toml:"ca_certificate"`
+	ClientCertificate     string `toml:"client_certificate"`
+	ClientKey             string `toml:"client_key"`
+	InsecureSkipVerify    bool   `toml:"insecure_skip_verify"`
+	Proxy                 string `toml:"proxy"`
+	MaxIdleConns          int    `toml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int    `toml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int    `toml:"max_conns_per_host"`
+	DialTimeout           string `toml:"dial_timeout"`
+	TLSHandshakeTimeout   string `toml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout string `toml:"response_header_timeout"`
+	IdleConnTimeout       string `toml:"idle_conn_timeout"`
+	RequestTimeout        string `toml:"request_timeout"`
+	RecordFile            string `toml:"record_file"`
+	ReplayFile            string `toml:"replay_file"`
+}
+
+func parseOptionalDuration(name, raw string) (time.Duration, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+
+	if duration, err := time.ParseDuration(raw); err != nil {
+		return 0, fmt.Errorf("%s is malformed: %w", name, err)
+	} else {
+		return duration, nil
+	}
+}
+
+func (s Transport) Options() (apitools.TransportOptions, error) {
+	var (
+		err     error
+		options = apitools.TransportOptions{
+			CACertFile:          s.CACertificate,
+			ClientCertFile:      s.ClientCertificate,
+			ClientKeyFile:       s.ClientKey,
+			InsecureSkipVerify:  s.InsecureSkipVerify,
+			ProxyURL:            s.Proxy,
+			MaxIdleConns:        s.MaxIdleConns,
+			MaxIdleConnsPerHost: s.MaxIdleConnsPerHost,
+			MaxConnsPerHost:     s.MaxConnsPerHost,
+			RecordPath:          s.RecordFile,
+			ReplayPath:          s.ReplayFile,
+		}
+	)
+
+	if len(options.RecordPath) > 0 && len(options.ReplayPath) > 0 {
+		return options, fmt.Errorf("record_file and replay_file can not both be set")
+	}
+
+	if options.DialTimeout, err = parseOptionalDuration("dial_timeout", s.DialTimeout); err != nil {
+		return options, err
+	} else if options.TLSHandshakeTimeout, err = parseOptionalDuration("tls_handshake_timeout", s.TLSHandshakeTimeout); err != nil {
+		return options, err
+	} else if options.ResponseHeaderTimeout, err = parseOptionalDuration("response_header_timeout", s.ResponseHeaderTimeout); err != nil {
+		return options, err
+	} else if options.IdleConnTimeout, err = parseOptionalDuration("idle_conn_timeout", s.IdleConnTimeout); err != nil {
+		return options, err
+	} else if options.RequestTimeout, err = parseOptionalDuration("request_timeout", s.RequestTimeout); err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+// NewHTTPClient builds an HTTP client for this transport configuration, loading
+// any referenced certificate material from disk.
+func (s Transport) NewHTTPClient() (*http.Client, error) {
+	if options, err := s.Options(); err != nil {
+		return nil, err
+	} else {
+		return apitools.NewHTTPClient(options)
+	}
+}
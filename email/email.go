@@ -3,7 +3,11 @@ package email
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"strings"
 
 	"github.com/zinic/forculus/config"
@@ -20,7 +24,68 @@ func tlsDial(smtpServer config.SMTPServer) (*tls.Conn, error) {
 	return tls.Dial("tcp", smtpServer.FormatAddress(), tlsConfig(smtpServer))
 }
 
-func formatMessage(email Email, smtpServer config.SMTPServer) []byte {
+// writeBase64 writes the content base64 encoded in lines of at most 76
+// characters as required by RFC 2045
+func writeBase64(buffer *bytes.Buffer, content []byte) {
+	const lineLength = 76
+
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > lineLength {
+		buffer.WriteString(encoded[:lineLength])
+		buffer.WriteString("\r\n")
+
+		encoded = encoded[lineLength:]
+	}
+
+	buffer.WriteString(encoded)
+	buffer.WriteString("\r\n")
+}
+
+func formatMultipartBody(messageBuffer *bytes.Buffer, email Email) error {
+	var (
+		partBuffer = &bytes.Buffer{}
+		writer     = multipart.NewWriter(partBuffer)
+	)
+
+	fmt.Fprintf(messageBuffer, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(messageBuffer, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	if part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": []string{"text/plain; charset=utf-8"},
+	}); err != nil {
+		return err
+	} else if _, err := part.Write([]byte(email.Body)); err != nil {
+		return err
+	}
+
+	for _, attachment := range email.Attachments {
+		var (
+			encoded = &bytes.Buffer{}
+			header  = textproto.MIMEHeader{
+				"Content-Type":              []string{attachment.ContentType},
+				"Content-Transfer-Encoding": []string{"base64"},
+				"Content-Disposition":       []string{fmt.Sprintf("attachment; filename=\"%s\"", attachment.Filename)},
+			}
+		)
+
+		writeBase64(encoded, attachment.Content)
+
+		if part, err := writer.CreatePart(header); err != nil {
+			return err
+		} else if _, err := part.Write(encoded.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	_, err := messageBuffer.Write(partBuffer.Bytes())
+	return err
+}
+
+func formatMessage(email Email, smtpServer config.SMTPServer) ([]byte, error) {
 	var (
 		messageBuffer = &bytes.Buffer{}
 		headers       = map[string]string{
@@ -37,16 +102,29 @@ func formatMessage(email Email, smtpServer config.SMTPServer) []byte {
 		messageBuffer.WriteString("\r\n")
 	}
 
-	messageBuffer.WriteString("\r\n")
-	messageBuffer.WriteString(email.Body)
+	if len(email.Attachments) > 0 {
+		if err := formatMultipartBody(messageBuffer, email); err != nil {
+			return nil, err
+		}
+	} else {
+		messageBuffer.WriteString("\r\n")
+		messageBuffer.WriteString(email.Body)
+	}
+
+	return messageBuffer.Bytes(), nil
+}
 
-	return messageBuffer.Bytes()
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
 }
 
 type Email struct {
-	Subject    string
-	Body       string
-	Recipients []string
+	Subject     string
+	Body        string
+	Recipients  []string
+	Attachments []Attachment
 }
 
 func (s Email) FormatRecipients() string {
@@ -79,12 +157,14 @@ func Send(email Email, smtpServer config.SMTPServer) error {
 				}
 			}
 
-			if dataWriter, err := smtpClient.Data(); err != nil {
+			if message, err := formatMessage(email, smtpServer); err != nil {
+				return err
+			} else if dataWriter, err := smtpClient.Data(); err != nil {
 				return err
 			} else {
 				defer dataWriter.Close()
 
-				if _, err := dataWriter.Write(formatMessage(email, smtpServer)); err != nil {
+				if _, err := dataWriter.Write(message); err != nil {
 					return err
 				}
 			}
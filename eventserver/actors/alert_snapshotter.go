@@ -0,0 +1,60 @@
+package actors
+
+import (
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+func RegisterAlertSnapshotter(reactor eventserver.SubscriptionManager, clients map[string]zmapi.Client) {
+	snapshotter := &AlertSnapshotter{
+		clients:  clients,
+		dispatch: reactor,
+	}
+
+	reactor.Register("alert_snapshotter", snapshotter.Logic, eventserver.MonitorAlerted)
+}
+
+// AlertSnapshotter grabs a live frame from monitors as they become alerted so
+// that notifications can be sent before the event closes
+type AlertSnapshotter struct {
+	clients  map[string]zmapi.Client
+	dispatch eventserver.EventDispatch
+}
+
+func (s *AlertSnapshotter) snapshot(alertedMonitor zmapi.AlertedMonitor) {
+	client, hasClient := s.clients[alertedMonitor.Monitor.Server]
+	if !hasClient {
+		log.Errorf("Alerted monitor %s references an unknown zoneminder server %s", alertedMonitor.Monitor.Name(), alertedMonitor.Monitor.Server)
+		return
+	}
+
+	if snapshot, err := client.Snapshot(alertedMonitor.Monitor); err != nil {
+		log.Errorf("Failed to grab a snapshot of alerted monitor %s on %s: %v", alertedMonitor.Monitor.Name(), alertedMonitor.Monitor.Server, err)
+	} else {
+		s.dispatch.Send(eventserver.Event{
+			Type: eventserver.MonitorAlertSnapshot,
+			Payload: MonitorAlertSnapshotPayload{
+				Source:   alertedMonitor,
+				Snapshot: snapshot,
+			},
+		})
+	}
+}
+
+func (s *AlertSnapshotter) Logic(eventC <-chan eventserver.Event, exitC chan struct{}) {
+	for {
+		select {
+		case nextEvent := <-eventC:
+			var alertedMonitor zmapi.AlertedMonitor
+			if err := nextEvent.Decode(&alertedMonitor); err != nil {
+				log.Errorf("Alert snapshotter received an unexpected event: %v", err)
+			} else {
+				s.snapshot(alertedMonitor)
+			}
+
+		case <-exitC:
+			return
+		}
+	}
+}
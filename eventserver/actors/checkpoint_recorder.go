@@ -0,0 +1,58 @@
+package actors
+
+import (
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/eventserver/statedb"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+func RegisterCheckpointRecorder(reactor eventserver.SubscriptionManager, database *statedb.Database) {
+	recorder := &CheckpointRecorder{
+		database: database,
+	}
+
+	reactor.Register("checkpoint_recorder", recorder.Logic, eventserver.MonitorNewEvent)
+}
+
+// CheckpointRecorder advances the per-server checkpoint in the state database
+// as new events are dispatched
+type CheckpointRecorder struct {
+	database *statedb.Database
+}
+
+func (s *CheckpointRecorder) record(monitorEvent zmapi.MonitorEvent) {
+	var checkpoint statedb.Checkpoint
+
+	if eventID, err := monitorEvent.ParseID(); err != nil {
+		log.Errorf("Failed to parse ID of event %s from %s: %v", monitorEvent.ID, monitorEvent.Server, err)
+		return
+	} else if eventTime, err := monitorEvent.ParseStartTime(); err != nil {
+		log.Errorf("Failed to parse start time of event %s from %s: %v", monitorEvent.ID, monitorEvent.Server, err)
+		return
+	} else {
+		checkpoint.EventID = eventID
+		checkpoint.EventTime = eventTime
+	}
+
+	if err := s.database.AdvanceCheckpoint(monitorEvent.Server, checkpoint); err != nil {
+		log.Errorf("Failed to record checkpoint for %s: %v", monitorEvent.Server, err)
+	}
+}
+
+func (s *CheckpointRecorder) Logic(eventC <-chan eventserver.Event, exitC chan struct{}) {
+	for {
+		select {
+		case nextEvent := <-eventC:
+			var monitorEvent zmapi.MonitorEvent
+			if err := nextEvent.Decode(&monitorEvent); err != nil {
+				log.Errorf("Checkpoint recorder received an unexpected event: %v", err)
+			} else {
+				s.record(monitorEvent)
+			}
+
+		case <-exitC:
+			return
+		}
+	}
+}
@@ -2,23 +2,27 @@ package actors
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/zinic/forculus/eventserver"
 
 	"github.com/zinic/forculus/config"
 	"github.com/zinic/forculus/email"
+	"github.com/zinic/forculus/eventserver/services"
 	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
 	"github.com/zinic/forculus/zoneminder/zmapi"
 )
 
-func RegisterEventEmailSender(reactor eventserver.SubscriptionManager, name string, alert config.EmailAlert, server config.SMTPServer) {
+func RegisterEventEmailSender(reactor eventserver.SubscriptionManager, name string, alert config.EmailAlert, server config.SMTPServer, options eventserver.SubscriptionOptions) error {
 	emailSender := &EventEmailSender{
 		name:   name,
 		alert:  alert,
 		server: server,
 	}
 
-	reactor.Register(emailSender.Logic, eventserver.All)
+	_, err := reactor.RegisterWithOptions(emailSender.Logic, options, eventserver.All)
+	return err
 }
 
 type EventEmailSender struct {
@@ -27,6 +31,21 @@ type EventEmailSender struct {
 	server config.SMTPServer
 }
 
+func (s *EventEmailSender) send(body string, attachments ...email.Attachment) {
+	emailTemplate := email.Email{
+		Subject:     s.alert.SubjectTemplate,
+		Body:        body,
+		Recipients:  s.alert.Recipients,
+		Attachments: attachments,
+	}
+
+	if err := email.Send(emailTemplate, s.server); err != nil {
+		log.Errorf("Failed sending email for alert %s: %v", s.name, err)
+	} else {
+		log.Infof("Email alert %s triggered", s.name)
+	}
+}
+
 func (s *EventEmailSender) handleEvent(nextEvent eventserver.Event) {
 	if s.alert.Filter.EventTrigger != "" && nextEvent.Type != s.alert.Filter.EventTrigger {
 		return
@@ -34,7 +53,16 @@ func (s *EventEmailSender) handleEvent(nextEvent eventserver.Event) {
 
 	switch nextEvent.Type {
 	case eventserver.MonitorAlerted:
-		alertedMonitor := nextEvent.Payload.(zmapi.AlertedMonitor)
+		var alertedMonitor zmapi.AlertedMonitor
+		if err := nextEvent.Decode(&alertedMonitor); err != nil {
+			log.Errorf("Email alert %s received an unexpected event: %v", s.name, err)
+			return
+		}
+
+		if !s.alert.Filter.AcceptsServer(alertedMonitor.Monitor.Server) {
+			return
+		}
+
 		if alertFrames, err := alertedMonitor.Monitor.Details.ParseAlertFrameCount(); err != nil {
 			log.Errorf("Failed to parse alert frame count for monitor %s: %v", alertedMonitor.Monitor.Details.Name, err)
 			return
@@ -42,50 +70,163 @@ func (s *EventEmailSender) handleEvent(nextEvent eventserver.Event) {
 			return
 		}
 
+		if !s.alert.Filter.AcceptsGroups(alertedMonitor.Monitor.Groups) {
+			return
+		}
+
 		if s.alert.Filter.NameRegex != nil && !s.alert.Filter.NameRegex.MatchString(alertedMonitor.Monitor.Details.Name) {
 			log.Debugf("Alerted monitor %s did not match alert %s regex %s",
 				alertedMonitor.Monitor.Details.Name, s.name, s.alert.Filter.NameRegex)
 			return
 		}
 
-		emailTemplate := email.Email{
-			Subject:    s.alert.SubjectTemplate,
-			Body:       fmt.Sprintf("Monitor %s has become alerted.", alertedMonitor.Monitor.Name()),
-			Recipients: s.alert.Recipients,
+		s.send(fmt.Sprintf("Monitor %s on %s has become alerted.", alertedMonitor.Monitor.Name(), alertedMonitor.Monitor.Server))
+
+	case eventserver.MonitorAlertSnapshot:
+		// Snapshots accompany every MonitorAlerted event so they are only sent
+		// to alerts that explicitly ask for them
+		if s.alert.Filter.EventTrigger != eventserver.MonitorAlertSnapshot {
+			return
+		}
+
+		var snapshotPayload MonitorAlertSnapshotPayload
+		if err := nextEvent.Decode(&snapshotPayload); err != nil {
+			log.Errorf("Email alert %s received an unexpected event: %v", s.name, err)
+			return
+		}
+
+		if !s.alert.Filter.AcceptsServer(snapshotPayload.Source.Monitor.Server) {
+			return
+		}
+
+		if !s.alert.Filter.AcceptsGroups(snapshotPayload.Source.Monitor.Groups) {
+			return
 		}
 
-		if err := email.Send(emailTemplate, s.server); err != nil {
-			log.Errorf("Failed sending email for alert %s: %v", s.name, err)
-		} else {
-			log.Infof("Email alert %s triggered", s.name)
+		if s.alert.Filter.NameRegex != nil && !s.alert.Filter.NameRegex.MatchString(snapshotPayload.Source.Monitor.Details.Name) {
+			return
 		}
 
+		attachment := email.Attachment{
+			Filename:    snapshotPayload.Snapshot.Filename(),
+			ContentType: snapshotPayload.Snapshot.ContentType,
+			Content:     snapshotPayload.Snapshot.Image,
+		}
+
+		s.send(fmt.Sprintf("Monitor %s on %s has become alerted. A snapshot taken at %s is attached.",
+			snapshotPayload.Source.Monitor.Name(), snapshotPayload.Source.Monitor.Server,
+			snapshotPayload.Snapshot.CapturedAt.Format("2006-01-02 15:04:05 MST")), attachment)
+
 	case eventserver.MonitorEventRecorded:
-		eventRecordedPayload := nextEvent.Payload.(MonitorEventRecordedPayload)
+		var eventRecordedPayload MonitorEventRecordedPayload
+		if err := nextEvent.Decode(&eventRecordedPayload); err != nil {
+			log.Errorf("Email alert %s received an unexpected event: %v", s.name, err)
+			return
+		}
+
+		if !s.alert.Filter.AcceptsServer(eventRecordedPayload.Source.Server) {
+			return
+		}
+
+		if !s.alert.Filter.AcceptsGroups(eventRecordedPayload.Source.Groups) {
+			return
+		}
+
 		if s.alert.Filter.NameRegex != nil && !s.alert.Filter.NameRegex.MatchString(eventRecordedPayload.Source.Name) {
 			log.Debugf("Monitor event %s did not match alert %s regex %s",
 				eventRecordedPayload.Source.Name, s.name, s.alert.Filter.NameRegex)
 			return
 		}
 
+		if !s.alert.Filter.AcceptsZones(eventRecordedPayload.Source.Zones) {
+			log.Debugf("Monitor event %s triggered by zones %v did not match alert %s zone filter",
+				eventRecordedPayload.Source.Name, eventRecordedPayload.Source.Zones, s.name)
+			return
+		}
+
 		if alertFrames, err := eventRecordedPayload.Source.ParseAlertFrames(); err != nil {
 			log.Errorf("Failed to parse alert frame count for monitor event ass %s: %v", eventRecordedPayload.Source.Name, err)
 		} else if s.alert.Filter.AlertFrameThreshold > 0 && s.alert.Filter.AlertFrameThreshold > alertFrames {
 			return
 		}
 
-		body := fmt.Sprintf("A new monitor event %s (%s) has become available.", eventRecordedPayload.Source.Name, eventRecordedPayload.AccessURL)
-		emailTemplate := email.Email{
-			Subject:    s.alert.SubjectTemplate,
-			Body:       body,
-			Recipients: s.alert.Recipients,
+		body := fmt.Sprintf("A new monitor event %s from %s started at %s (%s) has become available.",
+			eventRecordedPayload.Source.Name, eventRecordedPayload.Source.Server, eventRecordedPayload.Source.FormatStartTime(), eventRecordedPayload.AccessURL)
+
+		if len(eventRecordedPayload.Source.Zones) > 0 {
+			body += fmt.Sprintf(" Triggered by zones: %s.", strings.Join(eventRecordedPayload.Source.Zones, ", "))
+		}
+
+		s.send(body)
+
+	case eventserver.MonitorOffline, eventserver.MonitorOnline, eventserver.MonitorCaptureStalled, eventserver.MonitorCaptureResumed:
+		var monitorHealth services.MonitorHealthPayload
+		if err := nextEvent.Decode(&monitorHealth); err != nil {
+			log.Errorf("Email alert %s received an unexpected event: %v", s.name, err)
+			return
 		}
 
-		if err := email.Send(emailTemplate, s.server); err != nil {
-			log.Errorf("Failed sending email for alert %s: %v", s.name, err)
-		} else {
-			log.Infof("Email alert %s triggered", s.name)
+		if !s.alert.Filter.AcceptsServer(monitorHealth.Monitor.Server) {
+			return
+		}
+
+		if !s.alert.Filter.AcceptsGroups(monitorHealth.Monitor.Groups) {
+			return
+		}
+
+		if s.alert.Filter.NameRegex != nil && !s.alert.Filter.NameRegex.MatchString(monitorHealth.Monitor.Details.Name) {
+			return
+		}
+
+		s.send(fmt.Sprintf("Monitor %s on %s reported %s: %s.",
+			monitorHealth.Monitor.Name(), monitorHealth.Monitor.Server, nextEvent.Type, monitorHealth.Detail))
+
+	case eventserver.ZoneminderUnreachable, eventserver.ZoneminderReachable,
+		eventserver.ZoneminderDaemonStopped, eventserver.ZoneminderDaemonRunning,
+		eventserver.ZoneminderDiskHigh, eventserver.ZoneminderDiskNormal,
+		eventserver.ZoneminderLoadHigh, eventserver.ZoneminderLoadNormal:
+		var hostHealth services.HostHealthPayload
+		if err := nextEvent.Decode(&hostHealth); err != nil {
+			log.Errorf("Email alert %s received an unexpected event: %v", s.name, err)
+			return
 		}
+
+		if !s.alert.Filter.AcceptsServer(hostHealth.Server) {
+			return
+		}
+
+		s.send(fmt.Sprintf("Zoneminder %s reported %s: %s.", hostHealth.Server, nextEvent.Type, hostHealth.Detail))
+
+	case eventserver.ZoneminderLogMatched:
+		var logMatched services.LogMatchedPayload
+		if err := nextEvent.Decode(&logMatched); err != nil {
+			log.Errorf("Email alert %s received an unexpected event: %v", s.name, err)
+			return
+		}
+
+		if !s.alert.Filter.AcceptsServer(logMatched.Server) {
+			return
+		}
+
+		s.send(fmt.Sprintf("Zoneminder %s logged a line matching %s from %s at %s: [%s] %s",
+			logMatched.Server, logMatched.Pattern, logMatched.Entry.Component,
+			logMatched.Time.Format("2006-01-02 15:04:05 MST"), logMatched.Entry.Code, logMatched.Entry.Message))
+
+	case eventserver.ActorCrashed:
+		var crash service.CrashReport
+		if err := nextEvent.Decode(&crash); err != nil {
+			log.Errorf("Email alert %s received an unexpected event: %v", s.name, err)
+			return
+		}
+
+		body := fmt.Sprintf("Forculus handler %s crashed at %s: %s.",
+			crash.Name, crash.Time.Format("2006-01-02 15:04:05 MST"), crash.Reason)
+
+		if crash.GaveUp {
+			body += " It will not be restarted."
+		}
+
+		s.send(body)
 	}
 
 }
@@ -95,6 +236,7 @@ func (s *EventEmailSender) Logic(eventC <-chan eventserver.Event, exitC chan str
 		select {
 		case nextEvent := <-eventC:
 			s.handleEvent(nextEvent)
+			nextEvent.Ack()
 
 		case <-exitC:
 			return
@@ -1,32 +1,114 @@
 package actors
 
 import (
+	"strings"
+
 	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/eventserver/services"
 	"github.com/zinic/forculus/log"
 
 	"github.com/zinic/forculus/zoneminder/zmapi"
 )
 
+func logEvent(nextEvent eventserver.Event) error {
+	switch nextEvent.Type {
+	case eventserver.MonitorAlerted, eventserver.MonitorAlertStatusChanged, eventserver.MonitorExitingAlert:
+		var alertedMonitor zmapi.AlertedMonitor
+		if err := nextEvent.Decode(&alertedMonitor); err != nil {
+			return err
+		}
+
+		switch nextEvent.Type {
+		case eventserver.MonitorAlerted:
+			log.Infof("Monitor %s has entered alert status %s", alertedMonitor.Monitor.Name(), alertedMonitor.AlarmStatus)
+
+		case eventserver.MonitorAlertStatusChanged:
+			log.Infof("Monitor %s alert status has changed to %s", alertedMonitor.Monitor.Name(), alertedMonitor.AlarmStatus)
+
+		default:
+			log.Infof("Monitor %s has exited alert status", alertedMonitor.Monitor.Name())
+		}
+
+	case eventserver.MonitorAlertSnapshot:
+		var snapshotPayload MonitorAlertSnapshotPayload
+		if err := nextEvent.Decode(&snapshotPayload); err != nil {
+			return err
+		}
+
+		log.Infof("Snapshot of alerted monitor %s on %s captured (%d bytes)",
+			snapshotPayload.Source.Monitor.Name(), snapshotPayload.Source.Monitor.Server, len(snapshotPayload.Snapshot.Image))
+
+	case eventserver.MonitorEventStarted, eventserver.MonitorNewEvent:
+		var monitorEvent zmapi.MonitorEvent
+		if err := nextEvent.Decode(&monitorEvent); err != nil {
+			return err
+		}
+
+		if nextEvent.Type == eventserver.MonitorEventStarted {
+			log.Infof("Monitor event %s has started on %s", monitorEvent.Name, monitorEvent.Server)
+		} else {
+			log.Infof("New monitor event %s has been created on %s", monitorEvent.Name, monitorEvent.Server)
+		}
+
+	case eventserver.RunStateChanged:
+		var runStateChanged services.RunStateChangedPayload
+		if err := nextEvent.Decode(&runStateChanged); err != nil {
+			return err
+		}
+
+		log.Infof("Run state for %s has changed from %s to %s", runStateChanged.Server, runStateChanged.Previous, runStateChanged.Current)
+
+	case eventserver.MonitorAdded, eventserver.MonitorRemoved, eventserver.MonitorConfigChanged:
+		var monitorChanged services.MonitorChangedPayload
+		if err := nextEvent.Decode(&monitorChanged); err != nil {
+			return err
+		}
+
+		if nextEvent.Type == eventserver.MonitorConfigChanged {
+			log.Infof("Monitor %s on %s changed configuration: %s",
+				monitorChanged.Monitor.Name(), monitorChanged.Monitor.Server, strings.Join(monitorChanged.Changes, ", "))
+		} else {
+			log.Infof("Monitor %s on %s: %s", monitorChanged.Monitor.Name(), monitorChanged.Monitor.Server, nextEvent.Type)
+		}
+
+	case eventserver.MonitorOffline, eventserver.MonitorOnline, eventserver.MonitorCaptureStalled, eventserver.MonitorCaptureResumed:
+		var monitorHealth services.MonitorHealthPayload
+		if err := nextEvent.Decode(&monitorHealth); err != nil {
+			return err
+		}
+
+		log.Infof("Monitor %s on %s: %s (%s)", monitorHealth.Monitor.Name(), monitorHealth.Monitor.Server, nextEvent.Type, monitorHealth.Detail)
+
+	case eventserver.ZoneminderUnreachable, eventserver.ZoneminderReachable,
+		eventserver.ZoneminderDaemonStopped, eventserver.ZoneminderDaemonRunning,
+		eventserver.ZoneminderDiskHigh, eventserver.ZoneminderDiskNormal,
+		eventserver.ZoneminderLoadHigh, eventserver.ZoneminderLoadNormal:
+		var hostHealth services.HostHealthPayload
+		if err := nextEvent.Decode(&hostHealth); err != nil {
+			return err
+		}
+
+		log.Infof("Zoneminder %s: %s (%s)", hostHealth.Server, nextEvent.Type, hostHealth.Detail)
+
+	case eventserver.ZoneminderLogMatched:
+		var logMatched services.LogMatchedPayload
+		if err := nextEvent.Decode(&logMatched); err != nil {
+			return err
+		}
+
+		log.Infof("Zoneminder %s log line from %s matched pattern %s: %s",
+			logMatched.Server, logMatched.Entry.Component, logMatched.Pattern, logMatched.Entry.Message)
+	}
+
+	return nil
+}
+
 func EventLogger(eventC <-chan eventserver.Event, exitC chan struct{}) {
 	for {
 		select {
 		case nextEvent := <-eventC:
-			switch nextEvent.Type {
-			case eventserver.MonitorAlerted:
-				alertedMonitor := nextEvent.Payload.(zmapi.AlertedMonitor)
-				log.Infof("Monitor %s has entered alert status %s", alertedMonitor.Monitor.Name(), alertedMonitor.AlarmStatus)
-
-			case eventserver.MonitorAlertStatusChanged:
-				alertedMonitor := nextEvent.Payload.(zmapi.AlertedMonitor)
-				log.Infof("Monitor %s alert status has changed to %s", alertedMonitor.Monitor.Name(), alertedMonitor.AlarmStatus)
-
-			case eventserver.MonitorExitingAlert:
-				alertedMonitor := nextEvent.Payload.(zmapi.AlertedMonitor)
-				log.Infof("Monitor %s has exited alert status", alertedMonitor.Monitor.Name())
-
-			case eventserver.MonitorNewEvent:
-				monitorEvent := nextEvent.Payload.(zmapi.MonitorEvent)
-				log.Infof("New monitor event %s has been created", monitorEvent.Name)
+			if err := logEvent(nextEvent); err != nil {
+				log.Errorf("Event logger received an unexpected event: %v", err)
 			}
 
 		case <-exitC:
@@ -36,5 +118,5 @@ func EventLogger(eventC <-chan eventserver.Event, exitC chan struct{}) {
 }
 
 func RegisterEventLogger(reactor eventserver.SubscriptionManager) {
-	reactor.Register(EventLogger, eventserver.All)
+	reactor.Register("event_logger", EventLogger, eventserver.All)
 }
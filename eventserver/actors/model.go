@@ -1,6 +1,15 @@
 package actors
 
-import "github.com/zinic/forculus/zoneminder/zmapi"
+import (
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+func init() {
+	eventserver.RegisterPayload(MonitorEventUploadedPayload{}, eventserver.MonitorEventUploaded)
+	eventserver.RegisterPayload(MonitorEventRecordedPayload{}, eventserver.MonitorEventRecorded)
+	eventserver.RegisterPayload(MonitorAlertSnapshotPayload{}, eventserver.MonitorAlertSnapshot)
+}
 
 type MonitorEventUploadedPayload struct {
 	Source        zmapi.MonitorEvent
@@ -12,3 +21,8 @@ type MonitorEventRecordedPayload struct {
 	Source    zmapi.MonitorEvent
 	AccessURL string
 }
+
+type MonitorAlertSnapshotPayload struct {
+	Source   zmapi.AlertedMonitor
+	Snapshot zmapi.Snapshot
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/zinic/forculus/log"
 	"github.com/zinic/forculus/recordkeeper/rkapi"
 	"github.com/zinic/forculus/recordkeeper/rkdb"
+	"github.com/zinic/forculus/zoneminder/zmapi"
 )
 
 const (
@@ -26,7 +27,20 @@ func newAccessToken() string {
 	return string(buf)
 }
 
-func NewRecordKeeper(dispatch eventserver.EventDispatch, cfg config.RecordKeeperClient) eventserver.EventHandlerFunc {
+func NewRecordKeeper(dispatch eventserver.EventDispatch, cfg config.RecordKeeperClient) (eventserver.EventHandlerFunc, error) {
+	if rk, err := NewEventRecordKeeper(dispatch, cfg); err != nil {
+		return nil, err
+	} else {
+		return rk.Logic, nil
+	}
+}
+
+func NewEventRecordKeeper(dispatch eventserver.EventDispatch, cfg config.RecordKeeperClient) (*RecordKeeper, error) {
+	httpClient, err := cfg.Transport.NewHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
 	var (
 		endpoint    = apitools.NewEndpoint(cfg.Scheme, cfg.Host, cfg.Port, "")
 		credentials = rkapi.Credentials{
@@ -35,14 +49,12 @@ func NewRecordKeeper(dispatch eventserver.EventDispatch, cfg config.RecordKeeper
 		}
 	)
 
-	rk := &RecordKeeper{
+	return &RecordKeeper{
 		cfg:      cfg,
 		dispatch: dispatch,
 		endpoint: endpoint,
-		client:   rkapi.NewClient(credentials, endpoint),
-	}
-
-	return rk.Logic
+		client:   rkapi.NewClient(credentials, endpoint, httpClient),
+	}, nil
 }
 
 type RecordKeeper struct {
@@ -52,34 +64,68 @@ type RecordKeeper struct {
 	client   rkapi.Client
 }
 
+// Record creates a record keeper entry for an uploaded event
+func (s *RecordKeeper) Record(eventUploadedPayload MonitorEventUploadedPayload) (MonitorEventRecordedPayload, error) {
+	createRecordReq := rkdb.CreateEventRecord{
+		StorageTarget: eventUploadedPayload.StorageTarget,
+		StorageKey:    eventUploadedPayload.StorageKey,
+		AccessToken:   newAccessToken(),
+		Tags: map[string]string{
+			rkdb.ServerTag:  eventUploadedPayload.Source.Server,
+			rkdb.EventIDTag: eventUploadedPayload.Source.ID,
+		},
+	}
+
+	if newRecordID, err := s.client.CreateEventRecord(createRecordReq); err != nil {
+		return MonitorEventRecordedPayload{}, err
+	} else {
+		return MonitorEventRecordedPayload{
+			Source:    eventUploadedPayload.Source,
+			AccessURL: s.client.FormatEventURL(newRecordID, createRecordReq.AccessToken),
+		}, nil
+	}
+}
+
+// Recorded reports whether the event already has a record for the storage
+// target
+func (s *RecordKeeper) Recorded(storageTarget string, monitorEvent zmapi.MonitorEvent) (bool, error) {
+	source := rkdb.EventSource{
+		StorageTarget: storageTarget,
+		Server:        monitorEvent.Server,
+		EventID:       monitorEvent.ID,
+	}
+
+	if _, err := s.client.FindEventRecord(source); err != nil {
+		if err == rkdb.ErrEventNotFound {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
 func (s *RecordKeeper) Logic(eventC <-chan eventserver.Event, exitC chan struct{}) {
 	for {
 		select {
 		case nextEvent := <-eventC:
-			var (
-				eventUploadedPayload = nextEvent.Payload.(MonitorEventUploadedPayload)
-				createRecordReq      = rkdb.CreateEventRecord{
-					StorageTarget: eventUploadedPayload.StorageTarget,
-					StorageKey:    eventUploadedPayload.StorageKey,
-					AccessToken:   newAccessToken(),
-				}
-			)
-
-			if newRecordID, err := s.client.CreateEventRecord(createRecordReq); err != nil {
-				log.Errorf("Failed to create new event record via the record keeper API: %v")
+			var eventUploadedPayload MonitorEventUploadedPayload
+			if err := nextEvent.Decode(&eventUploadedPayload); err != nil {
+				log.Errorf("Record keeper received an unexpected event: %v", err)
+			} else if eventRecordedPayload, err := s.Record(eventUploadedPayload); err != nil {
+				log.Errorf("Failed to create new event record via the record keeper API: %v", err)
 			} else {
 				s.dispatch.Send(eventserver.Event{
-					Type: eventserver.MonitorEventRecorded,
-					Payload: MonitorEventRecordedPayload{
-						Source:    eventUploadedPayload.Source,
-						AccessURL: s.client.FormatEventURL(newRecordID, createRecordReq.AccessToken),
-					},
+					Type:    eventserver.MonitorEventRecorded,
+					Payload: eventRecordedPayload,
 				})
 			}
 
+			nextEvent.Ack()
+
 		case <-exitC:
 			return
 		}
 	}
-
 }
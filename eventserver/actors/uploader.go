@@ -2,6 +2,7 @@ package actors
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/zinic/forculus/config"
 	"github.com/zinic/forculus/eventserver"
@@ -10,68 +11,153 @@ import (
 	"github.com/zinic/forculus/zoneminder/zmapi"
 )
 
-func NewUploader(name string, dispatch eventserver.EventDispatch, zmClient zmapi.Client, storageProvider storage.Provider, cfg config.Uploader) eventserver.EventHandlerFunc {
-	uploader := &EventUploader{
+func NewUploader(name string, dispatch eventserver.EventDispatch, exporters map[string]zmapi.EventExporter, storageProvider storage.Provider, cfg config.Uploader) eventserver.EventHandlerFunc {
+	return NewEventUploader(name, dispatch, exporters, storageProvider, cfg).Logic
+}
+
+func NewEventUploader(name string, dispatch eventserver.EventDispatch, exporters map[string]zmapi.EventExporter, storageProvider storage.Provider, cfg config.Uploader) *EventUploader {
+	return &EventUploader{
 		name:            name,
 		dispatch:        dispatch,
-		zmClient:        zmClient,
+		exporters:       exporters,
 		storageProvider: storageProvider,
 		cfg:             cfg,
 	}
-
-	return uploader.Logic
 }
 
 type EventUploader struct {
 	name            string
 	dispatch        eventserver.EventDispatch
-	zmClient        zmapi.Client
+	exporters       map[string]zmapi.EventExporter
 	storageProvider storage.Provider
 	cfg             config.Uploader
 }
 
-func (s *EventUploader) Logic(eventC <-chan eventserver.Event, exitC chan struct{}) {
-	for {
-		select {
-		case nextEvent := <-eventC:
-			monitorEvent := nextEvent.Payload.(zmapi.MonitorEvent)
+// StorageKey is the key the export of the event is written to
+func (s *EventUploader) StorageKey(monitorEvent zmapi.MonitorEvent) string {
+	extension := s.cfg.Export.Extension()
+	if s.cfg.VideoOnly {
+		extension = "mp4"
+	}
 
-			if s.cfg.Filter.NameRegex != nil && !s.cfg.Filter.NameRegex.MatchString(monitorEvent.Name) {
-				log.Debugf("Event %s does not match the name regex filter for exporter %s", monitorEvent.Name, s.name)
-				continue
-			}
+	if s.cfg.ServerPrefix {
+		return fmt.Sprintf("%s/%s.%s", monitorEvent.Server, monitorEvent.Name, extension)
+	}
 
-			if alertFrames, err := monitorEvent.ParseAlertFrames(); err != nil {
-				log.Errorf("Failed to parse alert frames for event %s: %v", monitorEvent.Name, err)
-				continue
-			} else if s.cfg.Filter.AlertFrameThreshold > 0 && s.cfg.Filter.AlertFrameThreshold > alertFrames {
-				log.Debugf("Event %s does not meet the alert frame threshold for exporter %s", monitorEvent.Name, s.name)
-				continue
-			}
+	return fmt.Sprintf("%s.%s", monitorEvent.Name, extension)
+}
+
+// Stored reports whether an export of the event already exists in storage
+func (s *EventUploader) Stored(monitorEvent zmapi.MonitorEvent) (bool, error) {
+	if _, err := s.storageProvider.Stat(s.StorageKey(monitorEvent)); err == storage.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
 
-			eventFilename := fmt.Sprintf("%s.tar.gz", monitorEvent.Name)
-			log.Infof("Exporting event %s", monitorEvent.Name)
+func (s *EventUploader) export(exporter zmapi.EventExporter, monitorEvent zmapi.MonitorEvent) (string, io.ReadCloser, error) {
+	if s.cfg.VideoOnly {
+		log.Infof("Downloading video for event %s from %s", monitorEvent.Name, monitorEvent.Server)
 
-			if eventExportStream, err := s.zmClient.ExportEvent(monitorEvent); err != nil {
-				log.Errorf("Failed to download the MP4 video: %v", err)
-			} else {
-				if err := s.storageProvider.Write(eventFilename, eventExportStream); err != nil {
-					log.Errorf("Failed to upload event to storage provider: %v", err)
-				}
+		eventFilename := s.StorageKey(monitorEvent)
+		eventExportStream, err := exporter.DownloadMP4(monitorEvent)
+
+		return eventFilename, eventExportStream, err
+	}
+
+	log.Infof("Exporting event %s from %s", monitorEvent.Name, monitorEvent.Server)
+
+	eventFilename := s.StorageKey(monitorEvent)
+	eventExportStream, err := exporter.ExportEvent(monitorEvent, s.cfg.Export)
+
+	return eventFilename, eventExportStream, err
+}
+
+func (s *EventUploader) StorageTarget() string {
+	return s.cfg.StorageTarget
+}
+
+// Upload exports the event and writes it to the storage provider. It returns
+// false without an error if the event does not match the uploader's filter.
+func (s *EventUploader) Upload(monitorEvent zmapi.MonitorEvent) (MonitorEventUploadedPayload, bool, error) {
+	if !s.cfg.Filter.AcceptsServer(monitorEvent.Server) {
+		log.Debugf("Event %s from %s does not match the server filter for exporter %s", monitorEvent.Name, monitorEvent.Server, s.name)
+		return MonitorEventUploadedPayload{}, false, nil
+	}
+
+	exporter, hasExporter := s.exporters[monitorEvent.Server]
+	if !hasExporter {
+		return MonitorEventUploadedPayload{}, false, fmt.Errorf("event %s references an unknown zoneminder server %s", monitorEvent.Name, monitorEvent.Server)
+	}
+
+	if s.cfg.Filter.NameRegex != nil && !s.cfg.Filter.NameRegex.MatchString(monitorEvent.Name) {
+		log.Debugf("Event %s does not match the name regex filter for exporter %s", monitorEvent.Name, s.name)
+		return MonitorEventUploadedPayload{}, false, nil
+	}
+
+	if !s.cfg.Filter.AcceptsGroups(monitorEvent.Groups) {
+		log.Debugf("Event %s does not match the group filter for exporter %s", monitorEvent.Name, s.name)
+		return MonitorEventUploadedPayload{}, false, nil
+	}
+
+	if !s.cfg.Filter.AcceptsZones(monitorEvent.Zones) {
+		log.Debugf("Event %s triggered by zones %v does not match the zone filter for exporter %s", monitorEvent.Name, monitorEvent.Zones, s.name)
+		return MonitorEventUploadedPayload{}, false, nil
+	}
+
+	if alertFrames, err := monitorEvent.ParseAlertFrames(); err != nil {
+		return MonitorEventUploadedPayload{}, false, fmt.Errorf("failed to parse alert frames for event %s: %w", monitorEvent.Name, err)
+	} else if s.cfg.Filter.AlertFrameThreshold > 0 && s.cfg.Filter.AlertFrameThreshold > alertFrames {
+		log.Debugf("Event %s does not meet the alert frame threshold for exporter %s", monitorEvent.Name, s.name)
+		return MonitorEventUploadedPayload{}, false, nil
+	}
+
+	eventFilename, eventExportStream, err := s.export(exporter, monitorEvent)
+	if err != nil {
+		return MonitorEventUploadedPayload{}, false, fmt.Errorf("failed to export event %s: %w", monitorEvent.Name, err)
+	}
 
-				eventExportStream.Close()
+	defer eventExportStream.Close()
 
-				log.Infof("Event %s exported successfully", monitorEvent.Name)
+	if err := s.storageProvider.Write(eventFilename, eventExportStream); err != nil {
+		return MonitorEventUploadedPayload{}, false, fmt.Errorf("failed to upload event %s to storage provider: %w", monitorEvent.Name, err)
+	}
+
+	log.Infof("Event %s exported successfully", monitorEvent.Name)
+
+	return MonitorEventUploadedPayload{
+		Source:        monitorEvent,
+		StorageTarget: s.cfg.StorageTarget,
+		StorageKey:    eventFilename,
+	}, true, nil
+}
+
+func (s *EventUploader) handleEvent(monitorEvent zmapi.MonitorEvent) {
+	if payload, uploaded, err := s.Upload(monitorEvent); err != nil {
+		log.Errorf("Uploader %s: %v", s.name, err)
+	} else if uploaded {
+		s.dispatch.Send(eventserver.Event{
+			Type:    eventserver.MonitorEventUploaded,
+			Payload: payload,
+		})
+	}
+}
+
+func (s *EventUploader) Logic(eventC <-chan eventserver.Event, exitC chan struct{}) {
+	for {
+		select {
+		case nextEvent := <-eventC:
+			var monitorEvent zmapi.MonitorEvent
+			if err := nextEvent.Decode(&monitorEvent); err != nil {
+				log.Errorf("Uploader %s received an unexpected event: %v", s.name, err)
+			} else {
+				s.handleEvent(monitorEvent)
 			}
 
-			s.dispatch.Send(eventserver.Event{
-				Type: eventserver.MonitorEventUploaded,
-				Payload: MonitorEventUploadedPayload{
-					Source:        monitorEvent,
-					StorageTarget: s.cfg.StorageTarget,
-					StorageKey:    eventFilename,
-				},
-			})
+			nextEvent.Ack()
 
 		case <-exitC:
 			return
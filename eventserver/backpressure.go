@@ -0,0 +1,254 @@
+package eventserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BackpressurePolicy decides what happens to an event when the buffer of a
+// subscription is full
+type BackpressurePolicy string
+
+const (
+	// DropNewest discards the event being sent
+	DropNewest BackpressurePolicy = "drop_newest"
+
+	// DropOldest discards the oldest buffered event to make room
+	DropOldest BackpressurePolicy = "drop_oldest"
+
+	// Block waits for room in the buffer up to the block timeout, holding up
+	// whoever sent the event while it waits. Dispatch to other subscriptions
+	// carries on so that handlers which send events of their own do not stall.
+	Block BackpressurePolicy = "block"
+
+	// Spill writes events to a queue on disk until the handler catches up
+	Spill BackpressurePolicy = "spill"
+)
+
+const (
+	defaultBlockTimeout = time.Second * 30
+)
+
+func ParseBackpressurePolicy(raw string) (BackpressurePolicy, error) {
+	switch policy := BackpressurePolicy(raw); policy {
+	case "":
+		return DropNewest, nil
+
+	case DropNewest, DropOldest, Block, Spill:
+		return policy, nil
+
+	default:
+		return "", fmt.Errorf("unknown backpressure policy %s", raw)
+	}
+}
+
+type SubscriptionOptions struct {
+	Name         string
+	BufferSize   int
+	Policy       BackpressurePolicy
+	BlockTimeout time.Duration
+
+	// SpillPath is the directory the overflow queue of a Spill subscription is
+	// kept in
+	SpillPath string
+
+	// Journal makes the subscription durable. Events are journaled before
+	// delivery and replayed on restart until the handler acknowledges them.
+	// Durable subscriptions must be named.
+	Journal Journal
+}
+
+func (s SubscriptionOptions) withDefaults() SubscriptionOptions {
+	if s.BufferSize <= 0 {
+		s.BufferSize = defaultHandlerEventBuffer
+	}
+
+	if len(s.Policy) == 0 {
+		s.Policy = DropNewest
+	}
+
+	if s.BlockTimeout <= 0 {
+		s.BlockTimeout = defaultBlockTimeout
+	}
+
+	return s
+}
+
+// spillQueue is a FIFO of encoded events in a single file. Events are appended
+// as lines and read back in order; the file is truncated whenever the queue
+// drains so that it only grows while the handler is behind.
+type spillQueue struct {
+	lock    *sync.Mutex
+	path    string
+	writer  *os.File
+	reader  *os.File
+	buffer  *bufio.Reader
+	pending int
+	head    *Event
+	headSeq uint64
+}
+
+// newSpillQueue opens the overflow queue of the named subscription. Events left
+// behind by a previous run are delivered first unless discarded, which durable
+// subscriptions do since their journal replays those events instead.
+func newSpillQueue(directory, name string, discard bool) (*spillQueue, error) {
+	if len(directory) == 0 {
+		return nil, fmt.Errorf("no spill path set for subscription %s", name)
+	}
+
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spill path %s: %w", directory, err)
+	}
+
+	path := filepath.Join(directory, name+".spill")
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if discard {
+		flags |= os.O_TRUNC
+	}
+
+	writer, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill queue %s: %w", path, err)
+	}
+
+	reader, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to open spill queue %s: %w", path, err)
+	}
+
+	queue := &spillQueue{
+		lock:   &sync.Mutex{},
+		path:   path,
+		writer: writer,
+		reader: reader,
+		buffer: bufio.NewReader(reader),
+	}
+
+	if pending, err := countLines(path); err != nil {
+		queue.Close()
+		return nil, err
+	} else {
+		queue.pending = pending
+	}
+
+	return queue, nil
+}
+
+func countLines(path string) (int, error) {
+	input, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+
+	defer input.Close()
+
+	var (
+		lines  = 0
+		reader = bufio.NewReader(input)
+	)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 && err == nil {
+			lines++
+		}
+
+		if err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *spillQueue) Pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.pending
+}
+
+func (s *spillQueue) Push(event Event) error {
+	encoded, err := encodeEvent(event)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.writer.Write(append(encoded, '\n')); err != nil {
+		return err
+	}
+
+	s.pending++
+	return nil
+}
+
+// Peek returns the oldest queued event and its journal sequence without
+// removing it. Events that can no longer be decoded are returned as errors and
+// must still be committed.
+func (s *spillQueue) Peek() (Event, uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.head != nil {
+		return *s.head, s.headSeq, nil
+	}
+
+	if s.pending == 0 {
+		return Event{}, 0, io.EOF
+	}
+
+	line, err := s.buffer.ReadBytes('\n')
+	if err != nil {
+		return Event{}, 0, fmt.Errorf("failed to read spill queue %s: %w", s.path, err)
+	}
+
+	if event, sequence, err := decodeEvent(line); err != nil {
+		return Event{}, 0, err
+	} else {
+		s.head = &event
+		s.headSeq = sequence
+		return event, sequence, nil
+	}
+}
+
+// Commit removes the event returned by the last Peek
+func (s *spillQueue) Commit() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.head = nil
+	s.headSeq = 0
+
+	if s.pending > 0 {
+		s.pending--
+	}
+
+	if s.pending > 0 {
+		return nil
+	}
+
+	if err := s.writer.Truncate(0); err != nil {
+		return err
+	} else if _, err := s.reader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.buffer.Reset(s.reader)
+	return nil
+}
+
+func (s *spillQueue) Close() error {
+	s.writer.Close()
+	return s.reader.Close()
+}
@@ -0,0 +1,305 @@
+package eventserver
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const testEvent EventType = "test event"
+
+type testPayload struct {
+	Value int
+}
+
+func init() {
+	RegisterPayload(testPayload{}, testEvent)
+}
+
+func newTestEvent(value int) Event {
+	return Event{
+		Type:    testEvent,
+		Payload: testPayload{Value: value},
+	}
+}
+
+func payloadValue(t *testing.T, event Event) int {
+	var payload testPayload
+	if err := event.Decode(&payload); err != nil {
+		t.Fatalf("failed to decode test event: %v", err)
+	}
+
+	return payload.Value
+}
+
+func tempDir(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "eventserver")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	return directory
+}
+
+func drainValues(t *testing.T, eventC <-chan Event) []int {
+	var values []int
+
+	for {
+		select {
+		case event := <-eventC:
+			values = append(values, payloadValue(t, event))
+		default:
+			return values
+		}
+	}
+}
+
+func expectValues(t *testing.T, actual []int, expected ...int) {
+	if len(actual) != len(expected) {
+		t.Fatalf("expected events %v but got %v", expected, actual)
+	}
+
+	for idx := range expected {
+		if actual[idx] != expected[idx] {
+			t.Fatalf("expected events %v but got %v", expected, actual)
+		}
+	}
+}
+
+func TestSpillQueueOrder(t *testing.T) {
+	directory := tempDir(t)
+	defer os.RemoveAll(directory)
+
+	queue, err := newSpillQueue(directory, "spill", false)
+	if err != nil {
+		t.Fatalf("failed to open spill queue: %v", err)
+	}
+
+	for value := 1; value <= 3; value++ {
+		if err := queue.Push(newTestEvent(value)); err != nil {
+			t.Fatalf("failed to push event %d: %v", value, err)
+		}
+	}
+
+	if pending := queue.Pending(); pending != 3 {
+		t.Fatalf("expected 3 pending events but found %d", pending)
+	}
+
+	var values []int
+	for queue.Pending() > 0 {
+		event, _, err := queue.Peek()
+		if err != nil {
+			t.Fatalf("failed to peek spill queue: %v", err)
+		}
+
+		// Peeking again must not advance the queue
+		if again, _, err := queue.Peek(); err != nil || payloadValue(t, again) != payloadValue(t, event) {
+			t.Fatalf("peeking twice returned a different event")
+		}
+
+		values = append(values, payloadValue(t, event))
+
+		if err := queue.Commit(); err != nil {
+			t.Fatalf("failed to commit spill queue: %v", err)
+		}
+	}
+
+	expectValues(t, values, 1, 2, 3)
+
+	if _, _, err := queue.Peek(); err != io.EOF {
+		t.Fatalf("expected a drained queue to report EOF but got %v", err)
+	}
+
+	// The queue is truncated once drained and keeps working afterwards
+	if info, err := os.Stat(queue.path); err != nil {
+		t.Fatalf("failed to stat spill queue: %v", err)
+	} else if info.Size() != 0 {
+		t.Fatalf("expected a drained queue to be truncated but it holds %d bytes", info.Size())
+	}
+
+	if err := queue.Push(newTestEvent(4)); err != nil {
+		t.Fatalf("failed to push after draining: %v", err)
+	} else if event, _, err := queue.Peek(); err != nil {
+		t.Fatalf("failed to peek after draining: %v", err)
+	} else if value := payloadValue(t, event); value != 4 {
+		t.Fatalf("expected event 4 after draining but got %d", value)
+	}
+
+	queue.Close()
+}
+
+func TestSpillQueueReopen(t *testing.T) {
+	directory := tempDir(t)
+	defer os.RemoveAll(directory)
+
+	queue, err := newSpillQueue(directory, "spill", false)
+	if err != nil {
+		t.Fatalf("failed to open spill queue: %v", err)
+	}
+
+	for value := 1; value <= 2; value++ {
+		if err := queue.Push(newTestEvent(value)); err != nil {
+			t.Fatalf("failed to push event %d: %v", value, err)
+		}
+	}
+
+	queue.Close()
+
+	if reopened, err := newSpillQueue(directory, "spill", false); err != nil {
+		t.Fatalf("failed to reopen spill queue: %v", err)
+	} else if pending := reopened.Pending(); pending != 2 {
+		t.Fatalf("expected 2 events left from the previous run but found %d", pending)
+	} else if event, _, err := reopened.Peek(); err != nil {
+		t.Fatalf("failed to peek reopened spill queue: %v", err)
+	} else if value := payloadValue(t, event); value != 1 {
+		t.Fatalf("expected the oldest event first but got %d", value)
+	} else {
+		reopened.Close()
+	}
+
+	if discarded, err := newSpillQueue(directory, "spill", true); err != nil {
+		t.Fatalf("failed to reopen spill queue: %v", err)
+	} else if pending := discarded.Pending(); pending != 0 {
+		t.Fatalf("expected discarded events to be gone but found %d", pending)
+	} else {
+		discarded.Close()
+	}
+}
+
+func newTestSubscription(t *testing.T, options SubscriptionOptions) *subscription {
+	sub, err := NewSubscriptionWithOptions(func(eventC <-chan Event, exitC chan struct{}) {}, options, testEvent)
+	if err != nil {
+		t.Fatalf("failed to create subscription: %v", err)
+	}
+
+	return sub
+}
+
+func TestDropNewest(t *testing.T) {
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "drop newest", BufferSize: 2, Policy: DropNewest})
+
+	for value := 1; value <= 3; value++ {
+		if wait := sub.Send(newTestEvent(value)); wait != nil {
+			t.Fatalf("drop newest sends must not wait")
+		}
+	}
+
+	expectValues(t, drainValues(t, sub.eventC), 1, 2)
+
+	if info := sub.Info(); info.Dropped != 1 || info.Received != 3 {
+		t.Fatalf("expected 3 received and 1 dropped but got %d and %d", info.Received, info.Dropped)
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "drop oldest", BufferSize: 2, Policy: DropOldest})
+
+	for value := 1; value <= 4; value++ {
+		if wait := sub.Send(newTestEvent(value)); wait != nil {
+			t.Fatalf("drop oldest sends must not wait")
+		}
+	}
+
+	expectValues(t, drainValues(t, sub.eventC), 3, 4)
+
+	if dropped := sub.Info().Dropped; dropped != 2 {
+		t.Fatalf("expected 2 dropped events but got %d", dropped)
+	}
+}
+
+func TestBlockWaitsInOrder(t *testing.T) {
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "block", BufferSize: 1, Policy: Block, BlockTimeout: time.Second * 5})
+
+	if wait := sub.Send(newTestEvent(1)); wait != nil {
+		t.Fatalf("a send with room in the buffer must not wait")
+	}
+
+	var waits []func()
+	for value := 2; value <= 3; value++ {
+		if wait := sub.Send(newTestEvent(value)); wait == nil {
+			t.Fatalf("a send to a full buffer must wait")
+		} else {
+			waits = append(waits, wait)
+		}
+	}
+
+	// Waits run in reverse to show that they still deliver in dispatch order
+	doneC := make(chan struct{})
+	for idx := len(waits) - 1; idx >= 0; idx-- {
+		go func(wait func()) {
+			wait()
+			doneC <- struct{}{}
+		}(waits[idx])
+	}
+
+	var values []int
+	for len(values) < 3 {
+		select {
+		case event := <-sub.eventC:
+			values = append(values, payloadValue(t, event))
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for blocked events, received %v", values)
+		}
+	}
+
+	<-doneC
+	<-doneC
+
+	expectValues(t, values, 1, 2, 3)
+
+	if dropped := sub.Info().Dropped; dropped != 0 {
+		t.Fatalf("expected no dropped events but got %d", dropped)
+	}
+}
+
+func TestBlockTimeout(t *testing.T) {
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "block timeout", BufferSize: 1, Policy: Block, BlockTimeout: time.Millisecond * 10})
+
+	sub.Send(newTestEvent(1))
+
+	if wait := sub.Send(newTestEvent(2)); wait == nil {
+		t.Fatalf("a send to a full buffer must wait")
+	} else {
+		wait()
+	}
+
+	expectValues(t, drainValues(t, sub.eventC), 1)
+
+	if dropped := sub.Info().Dropped; dropped != 1 {
+		t.Fatalf("expected the timed out event to be dropped but %d were", dropped)
+	}
+}
+
+func TestSpillPreservesOrder(t *testing.T) {
+	directory := tempDir(t)
+	defer os.RemoveAll(directory)
+
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "spill", BufferSize: 1, Policy: Spill, SpillPath: directory})
+
+	for value := 1; value <= 4; value++ {
+		if wait := sub.Send(newTestEvent(value)); wait != nil {
+			t.Fatalf("spill sends must not wait")
+		}
+	}
+
+	if info := sub.Info(); info.Spilled != 3 || info.Pending != 3 {
+		t.Fatalf("expected 3 spilled and pending events but got %d and %d", info.Spilled, info.Pending)
+	}
+
+	go sub.drainOverflow()
+	defer sub.Stop()
+
+	var values []int
+	for len(values) < 4 {
+		select {
+		case event := <-sub.eventC:
+			values = append(values, payloadValue(t, event))
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for spilled events, received %v", values)
+		}
+	}
+
+	expectValues(t, values, 1, 2, 3, 4)
+}
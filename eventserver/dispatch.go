@@ -1,42 +1,202 @@
 package eventserver
 
 import (
+	"fmt"
 	"sync"
 
+	"github.com/zinic/forculus/errors"
+	"github.com/zinic/forculus/log"
 	"github.com/zinic/forculus/service"
 )
 
+const (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+)
+
 func NewDispatch(manager *service.Manager) SubscriptionManager {
-	return &reactor{
-		manager:      manager,
-		dispatchLock: &sync.Mutex{},
+	newReactor := &reactor{
+		manager:           manager,
+		dispatchLock:      &sync.Mutex{},
+		subscriptionsLock: &sync.RWMutex{},
 	}
+
+	manager.Notify(newReactor)
+	return newReactor
 }
 
 type reactor struct {
-	manager       *service.Manager
-	dispatchLock  *sync.Mutex
-	subscriptions []*subscription
+	manager           *service.Manager
+	dispatchLock      *sync.Mutex
+	subscriptionsLock *sync.RWMutex
+	subscriptions     []*subscription
+	lastID            SubscriptionID
+	replayed          bool
 }
 
 func (s *reactor) Stop() {
 	s.manager.Stop()
 }
 
-func (s *reactor) Register(handler EventHandlerFunc, interests ...EventType) {
-	newSubscription := NewSubscription(handler, interests...)
+func (s *reactor) Register(name string, handler EventHandlerFunc, interests ...EventType) SubscriptionID {
+	return s.start(NewSubscription(name, handler, interests...))
+}
+
+func (s *reactor) RegisterWithOptions(handler EventHandlerFunc, options SubscriptionOptions, interests ...EventType) (SubscriptionID, error) {
+	// Journals and spill queues are keyed by name
+	if options.Journal != nil || options.Policy == Spill {
+		for _, sub := range s.currentSubscriptions() {
+			if sub.name == options.Name {
+				return 0, fmt.Errorf("a subscription named %s is already registered", options.Name)
+			}
+		}
+	}
 
+	if newSubscription, err := NewSubscriptionWithOptions(handler, options, interests...); err != nil {
+		return 0, err
+	} else {
+		return s.start(newSubscription), nil
+	}
+}
+
+func (s *reactor) start(newSubscription *subscription) SubscriptionID {
+	s.subscriptionsLock.Lock()
+	s.lastID++
+	newSubscription.id = s.lastID
 	s.subscriptions = append(s.subscriptions, newSubscription)
+	replayed := s.replayed
+	s.subscriptionsLock.Unlock()
+
 	s.manager.Start(newSubscription)
+	s.manager.Supervise(newSubscription.supervisedName(), newSubscription.exitC, newSubscription.run)
+
+	log.Debugf("Subscription %d (%s) registered", newSubscription.id, newSubscription.name)
+
+	if replayed {
+		newSubscription.replay()
+	}
+
+	return newSubscription.id
 }
 
-func (s *reactor) Send(event Event) {
+func (s *reactor) Replay() {
+	s.subscriptionsLock.Lock()
+	s.replayed = true
+	s.subscriptionsLock.Unlock()
+
+	for _, sub := range s.currentSubscriptions() {
+		sub.replay()
+	}
+}
+
+func (s *reactor) find(id SubscriptionID) (*subscription, error) {
+	for _, sub := range s.currentSubscriptions() {
+		if sub.id == id {
+			return sub, nil
+		}
+	}
+
+	return nil, ErrSubscriptionNotFound
+}
+
+// Unregister stops the handler of the subscription. Events journaled for a
+// durable subscription are kept and replayed once it is registered again.
+func (s *reactor) Unregister(id SubscriptionID) error {
+	// Holding dispatch guarantees the subscription receives nothing once it
+	// has been removed
 	s.dispatchLock.Lock()
 	defer s.dispatchLock.Unlock()
 
-	for _, sub := range s.subscriptions {
-		if sub.Accepts(event.Type) {
-			sub.Send(event)
+	s.subscriptionsLock.Lock()
+	defer s.subscriptionsLock.Unlock()
+
+	for idx, sub := range s.subscriptions {
+		if sub.id == id {
+			s.subscriptions = append(s.subscriptions[:idx:idx], s.subscriptions[idx+1:]...)
+			sub.Stop()
+
+			log.Infof("Subscription %d (%s) unregistered", sub.id, sub.name)
+			return nil
 		}
 	}
+
+	return ErrSubscriptionNotFound
+}
+
+// Pause stops events from being sent to the subscription. Events dispatched
+// while it is paused are skipped rather than queued, and are not journaled
+// either, so a durable subscription will not see them after a restart.
+func (s *reactor) Pause(id SubscriptionID) error {
+	if sub, err := s.find(id); err != nil {
+		return err
+	} else {
+		sub.setPaused(true)
+		log.Infof("Subscription %d (%s) paused", sub.id, sub.name)
+	}
+
+	return nil
+}
+
+func (s *reactor) Resume(id SubscriptionID) error {
+	if sub, err := s.find(id); err != nil {
+		return err
+	} else {
+		sub.setPaused(false)
+		log.Infof("Subscription %d (%s) resumed", sub.id, sub.name)
+	}
+
+	return nil
+}
+
+func (s *reactor) currentSubscriptions() []*subscription {
+	s.subscriptionsLock.RLock()
+	defer s.subscriptionsLock.RUnlock()
+
+	return append([]*subscription(nil), s.subscriptions...)
+}
+
+func (s *reactor) Subscriptions() []SubscriptionInfo {
+	var (
+		subscriptions = s.currentSubscriptions()
+		infos         = make([]SubscriptionInfo, 0, len(subscriptions))
+	)
+
+	for _, sub := range subscriptions {
+		infos = append(infos, sub.Info())
+	}
+
+	return infos
+}
+
+func (s *reactor) Send(event Event) {
+	// A mismatched payload is a programming error. Rejecting it here keeps it
+	// from reaching handlers that expect the registered type.
+	if err := ValidatePayload(event); err != nil {
+		log.Errorf("Rejected event: %v", err)
+		return
+	}
+
+	var waits []func()
+
+	// Sends are serialized so that every subscription sees events in the same
+	// order. Blocked subscriptions are waited on once dispatch is released so
+	// that their handlers are free to send events while this one waits.
+	s.dispatchLock.Lock()
+
+	for _, sub := range s.currentSubscriptions() {
+		if !sub.Accepts(event.Type) {
+			continue
+		}
+
+		if sub.Paused() {
+			sub.skip()
+		} else if wait := sub.Send(event); wait != nil {
+			waits = append(waits, wait)
+		}
+	}
+
+	s.dispatchLock.Unlock()
+
+	for _, wait := range waits {
+		wait()
+	}
 }
@@ -0,0 +1,135 @@
+package inbound
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/eventserver/services"
+	"github.com/zinic/forculus/recordkeeper/server"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+const (
+	serverVarKey         = "server"
+	runStateVarKey       = "run_state"
+	daemonCommandVarKey  = "command"
+	subscriptionIDVarKey = "id"
+)
+
+func NewHandler(runStateControls map[string]*services.RunStateControl, cadences map[string]*services.PollCadence, subscriptions eventserver.SubscriptionManager) Handler {
+	return Handler{
+		runStateControls: runStateControls,
+		cadences:         cadences,
+		subscriptions:    subscriptions,
+	}
+}
+
+type Handler struct {
+	runStateControls map[string]*services.RunStateControl
+	cadences         map[string]*services.PollCadence
+	subscriptions    eventserver.SubscriptionManager
+}
+
+func (s Handler) runStateControl(resp server.ResponseWrapper, req *http.Request) (*services.RunStateControl, bool) {
+	serverName := mux.Vars(req)[serverVarKey]
+
+	if runStateControl, found := s.runStateControls[serverName]; found {
+		return runStateControl, true
+	}
+
+	resp.Errorf(http.StatusNotFound, "zoneminder server %s is not configured", serverName)
+	return nil, false
+}
+
+func (s Handler) writeJSON(resp server.ResponseWrapper, value interface{}) {
+	if output, err := json.Marshal(value); err != nil {
+		resp.Errorf(http.StatusInternalServerError, "response marshaling error: %v", err)
+	} else {
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(http.StatusOK)
+		resp.Write(output)
+	}
+}
+
+func (s Handler) GetRunStates(resp server.ResponseWrapper, req *http.Request) {
+	if runStateControl, found := s.runStateControl(resp, req); !found {
+		return
+	} else if runStates, err := runStateControl.States(); err != nil {
+		resp.Errorf(http.StatusBadGateway, "failed to list run states: %v", err)
+	} else {
+		s.writeJSON(resp, runStates)
+	}
+}
+
+func (s Handler) PostRunState(resp server.ResponseWrapper, req *http.Request) {
+	runState := mux.Vars(req)[runStateVarKey]
+
+	if runStateControl, found := s.runStateControl(resp, req); !found {
+		return
+	} else if err := runStateControl.Change(runState, fmt.Sprintf("inbound request from %s", req.RemoteAddr)); err != nil {
+		resp.Errorf(http.StatusBadGateway, "failed to change run state to %s: %v", runState, err)
+	} else {
+		resp.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s Handler) PostDaemonCommand(resp server.ResponseWrapper, req *http.Request) {
+	rawCommand := mux.Vars(req)[daemonCommandVarKey]
+
+	if runStateControl, found := s.runStateControl(resp, req); !found {
+		return
+	} else if command, valid := zmapi.ParseDaemonCommand(rawCommand); !valid {
+		resp.Errorf(http.StatusBadRequest, "unknown daemon command %s", rawCommand)
+	} else if err := runStateControl.ControlDaemons(command, fmt.Sprintf("inbound request from %s", req.RemoteAddr)); err != nil {
+		resp.Errorf(http.StatusBadGateway, "failed to %s daemons: %v", command, err)
+	} else {
+		resp.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s Handler) GetPollStatus(resp server.ResponseWrapper, req *http.Request) {
+	serverName := mux.Vars(req)[serverVarKey]
+
+	if cadence, found := s.cadences[serverName]; !found {
+		resp.Errorf(http.StatusNotFound, "zoneminder server %s is not configured", serverName)
+	} else {
+		s.writeJSON(resp, cadence.Status())
+	}
+}
+
+func (s Handler) GetSubscriptions(resp server.ResponseWrapper, req *http.Request) {
+	s.writeJSON(resp, s.subscriptions.Subscriptions())
+}
+
+// manageSubscription applies a runtime change to the subscription named by the
+// request path
+func (s Handler) manageSubscription(resp server.ResponseWrapper, req *http.Request, change func(id eventserver.SubscriptionID) error) {
+	rawID := mux.Vars(req)[subscriptionIDVarKey]
+
+	if id, err := strconv.ParseUint(rawID, 10, 64); err != nil {
+		resp.Errorf(http.StatusBadRequest, "malformed subscription id %s", rawID)
+	} else if err := change(eventserver.SubscriptionID(id)); err == eventserver.ErrSubscriptionNotFound {
+		resp.Errorf(http.StatusNotFound, "subscription %d is not registered", id)
+	} else if err != nil {
+		resp.Errorf(http.StatusInternalServerError, "failed to change subscription %d: %v", id, err)
+	} else {
+		resp.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s Handler) PostPauseSubscription(resp server.ResponseWrapper, req *http.Request) {
+	s.manageSubscription(resp, req, s.subscriptions.Pause)
+}
+
+func (s Handler) PostResumeSubscription(resp server.ResponseWrapper, req *http.Request) {
+	s.manageSubscription(resp, req, s.subscriptions.Resume)
+}
+
+func (s Handler) DeleteSubscription(resp server.ResponseWrapper, req *http.Request) {
+	s.manageSubscription(resp, req, s.subscriptions.Unregister)
+}
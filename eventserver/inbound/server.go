@@ -0,0 +1,62 @@
+package inbound
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/recordkeeper/server"
+	"github.com/zinic/forculus/service"
+)
+
+func newMux(handler Handler, users map[string]config.AuthorizationConfig) http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/zoneminder/{server}/run_state", server.AuthFilter(users, server.MethodFilter(handler.GetRunStates, http.MethodGet)))
+	router.HandleFunc("/zoneminder/{server}/run_state/{run_state}", server.AuthFilter(users, server.MethodFilter(handler.PostRunState, http.MethodPost)))
+	router.HandleFunc("/zoneminder/{server}/polling", server.AuthFilter(users, server.MethodFilter(handler.GetPollStatus, http.MethodGet)))
+	router.HandleFunc("/zoneminder/{server}/daemons/{command}", server.AuthFilter(users, server.MethodFilter(handler.PostDaemonCommand, http.MethodPost)))
+	router.HandleFunc("/subscriptions", server.AuthFilter(users, server.MethodFilter(handler.GetSubscriptions, http.MethodGet)))
+	router.HandleFunc("/subscriptions/{id}", server.AuthFilter(users, server.MethodFilter(handler.DeleteSubscription, http.MethodDelete)))
+	router.HandleFunc("/subscriptions/{id}/pause", server.AuthFilter(users, server.MethodFilter(handler.PostPauseSubscription, http.MethodPost)))
+	router.HandleFunc("/subscriptions/{id}/resume", server.AuthFilter(users, server.MethodFilter(handler.PostResumeSubscription, http.MethodPost)))
+
+	return router
+}
+
+func NewServer(cfg config.Inbound, handler Handler) service.Service {
+	return &Server{
+		httpServer: &http.Server{
+			Addr:    cfg.BindAddress,
+			Handler: newMux(handler, cfg.Users),
+		},
+		exitC: make(chan struct{}),
+	}
+}
+
+type Server struct {
+	httpServer *http.Server
+	exitC      chan struct{}
+}
+
+func (s *Server) serve() {
+	log.Infof("Inbound API listening on %s", s.httpServer.Addr)
+
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("Fatal error while running inbound HTTP server: %v", err)
+	}
+}
+
+func (s *Server) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("inbound API", s.exitC, s.serve)
+}
+
+func (s *Server) Stop() {
+	close(s.exitC)
+
+	if err := s.httpServer.Shutdown(context.Background()); err != nil {
+		log.Errorf("Error during inbound HTTP server shutdown: %v", err)
+	}
+}
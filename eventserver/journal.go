@@ -0,0 +1,28 @@
+package eventserver
+
+import (
+	"github.com/zinic/forculus/log"
+)
+
+// Journal persists events for durable subscriptions from the moment they are
+// dispatched until the handler of the subscription acknowledges them, so that
+// events still queued when the eventserver stops are delivered after a restart
+type Journal interface {
+	Append(subscription string, content []byte) (uint64, error)
+	Acknowledge(subscription string, sequence uint64) error
+	Pending(subscription string, visit func(sequence uint64, content []byte) error) error
+}
+
+// receipt ties an event delivered to a durable subscription to its journal
+// entry
+type receipt struct {
+	journal      Journal
+	subscription string
+	sequence     uint64
+}
+
+func (s *receipt) acknowledge() {
+	if err := s.journal.Acknowledge(s.subscription, s.sequence); err != nil {
+		log.Errorf("Failed to acknowledge journaled event %d for handler %s: %v", s.sequence, s.subscription, err)
+	}
+}
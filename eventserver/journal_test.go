@@ -0,0 +1,241 @@
+package eventserver
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryJournal is a Journal that keeps entries in memory
+type memoryJournal struct {
+	lock     *sync.Mutex
+	sequence uint64
+	entries  map[string]map[uint64][]byte
+}
+
+func newMemoryJournal() *memoryJournal {
+	return &memoryJournal{
+		lock:    &sync.Mutex{},
+		entries: make(map[string]map[uint64][]byte),
+	}
+}
+
+func (s *memoryJournal) Append(subscription string, content []byte) (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.entries[subscription] == nil {
+		s.entries[subscription] = make(map[uint64][]byte)
+	}
+
+	s.sequence++
+	s.entries[subscription][s.sequence] = content
+
+	return s.sequence, nil
+}
+
+func (s *memoryJournal) Acknowledge(subscription string, sequence uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.entries[subscription], sequence)
+	return nil
+}
+
+func (s *memoryJournal) Pending(subscription string, visit func(sequence uint64, content []byte) error) error {
+	s.lock.Lock()
+
+	var sequences []uint64
+	for sequence := range s.entries[subscription] {
+		sequences = append(sequences, sequence)
+	}
+
+	sort.Slice(sequences, func(i, j int) bool {
+		return sequences[i] < sequences[j]
+	})
+
+	contents := make([][]byte, len(sequences))
+	for idx, sequence := range sequences {
+		contents[idx] = s.entries[subscription][sequence]
+	}
+
+	s.lock.Unlock()
+
+	for idx, sequence := range sequences {
+		if err := visit(sequence, contents[idx]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryJournal) pending(subscription string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.entries[subscription])
+}
+
+func receiveValues(t *testing.T, eventC <-chan Event, count int) []Event {
+	var events []Event
+
+	for len(events) < count {
+		select {
+		case event := <-eventC:
+			events = append(events, event)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out after receiving %d of %d events", len(events), count)
+		}
+	}
+
+	return events
+}
+
+func eventValues(t *testing.T, events []Event) []int {
+	values := make([]int, len(events))
+	for idx, event := range events {
+		values[idx] = payloadValue(t, event)
+	}
+
+	return values
+}
+
+func TestJournalAcknowledge(t *testing.T) {
+	journal := newMemoryJournal()
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "durable", BufferSize: 4, Policy: Block, Journal: journal})
+
+	for value := 1; value <= 3; value++ {
+		sub.Send(newTestEvent(value))
+	}
+
+	if pending := journal.pending("durable"); pending != 3 {
+		t.Fatalf("expected 3 journaled events but found %d", pending)
+	}
+
+	events := receiveValues(t, sub.eventC, 3)
+	expectValues(t, eventValues(t, events), 1, 2, 3)
+
+	events[1].Ack()
+
+	if pending := journal.pending("durable"); pending != 2 {
+		t.Fatalf("expected 2 journaled events after an ack but found %d", pending)
+	}
+
+	// Acking twice is harmless
+	events[1].Ack()
+	events[0].Ack()
+	events[2].Ack()
+
+	if pending := journal.pending("durable"); pending != 0 {
+		t.Fatalf("expected every event to be acknowledged but %d are journaled", pending)
+	}
+}
+
+func TestJournalAcknowledgesDroppedEvents(t *testing.T) {
+	journal := newMemoryJournal()
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "durable", BufferSize: 1, Policy: Block, BlockTimeout: time.Millisecond * 10, Journal: journal})
+
+	sub.Send(newTestEvent(1))
+
+	if wait := sub.Send(newTestEvent(2)); wait != nil {
+		wait()
+	}
+
+	if pending := journal.pending("durable"); pending != 1 {
+		t.Fatalf("expected only the buffered event to stay journaled but found %d", pending)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	journal := newMemoryJournal()
+
+	// Journal events as a previous run would have left them
+	previous := newTestSubscription(t, SubscriptionOptions{Name: "durable", BufferSize: 4, Policy: Block, Journal: journal})
+	for value := 1; value <= 3; value++ {
+		previous.Send(newTestEvent(value))
+	}
+
+	receiveValues(t, previous.eventC, 3)[0].Ack()
+
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "durable", BufferSize: 1, Policy: Block, Journal: journal})
+
+	go sub.feedBacklog()
+	defer sub.Stop()
+
+	sub.replay()
+	sub.replay()
+
+	// The backlog is read when replay is called so events journaled later are
+	// only delivered once
+	go func() {
+		if wait := sub.Send(newTestEvent(4)); wait != nil {
+			wait()
+		}
+	}()
+
+	events := receiveValues(t, sub.eventC, 3)
+	values := eventValues(t, events)
+
+	// Live events may overtake the backlog but the backlog stays in order
+	var replayed []int
+	for _, value := range values {
+		if value != 4 {
+			replayed = append(replayed, value)
+		}
+	}
+
+	if len(replayed) != 2 {
+		t.Fatalf("expected the live event to be delivered once but got %v", values)
+	}
+
+	expectValues(t, replayed, 2, 3)
+
+	for _, event := range events {
+		event.Ack()
+	}
+
+	select {
+	case event := <-sub.eventC:
+		t.Fatalf("expected no further events but got %d", payloadValue(t, event))
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	if pending := journal.pending("durable"); pending != 0 {
+		t.Fatalf("expected every replayed event to be acknowledged but %d are journaled", pending)
+	}
+}
+
+func TestJournalReplaySpill(t *testing.T) {
+	directory := tempDir(t)
+	defer os.RemoveAll(directory)
+
+	journal := newMemoryJournal()
+	for value := 1; value <= 2; value++ {
+		if encoded, err := encodeEvent(newTestEvent(value)); err != nil {
+			t.Fatalf("failed to encode event: %v", err)
+		} else if _, err := journal.Append("spill", encoded); err != nil {
+			t.Fatalf("failed to journal event: %v", err)
+		}
+	}
+
+	sub := newTestSubscription(t, SubscriptionOptions{Name: "spill", BufferSize: 1, Policy: Spill, SpillPath: directory, Journal: journal})
+
+	go sub.drainOverflow()
+	defer sub.Stop()
+
+	sub.replay()
+
+	events := receiveValues(t, sub.eventC, 2)
+	expectValues(t, eventValues(t, events), 1, 2)
+
+	for _, event := range events {
+		event.Ack()
+	}
+
+	if pending := journal.pending("spill"); pending != 0 {
+		t.Fatalf("expected replayed spill events to be acknowledged but %d are journaled", pending)
+	}
+}
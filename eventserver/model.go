@@ -5,16 +5,56 @@ type EventType string
 const (
 	All                       EventType = "all events"
 	MonitorAlerted            EventType = "monitor alerted"
+	MonitorAlertSnapshot      EventType = "monitor alert snapshot"
 	MonitorAlertStatusChanged EventType = "monitor alert status changed"
 	MonitorExitingAlert       EventType = "monitor exiting alert"
+	MonitorEventStarted       EventType = "monitor event started"
 	MonitorNewEvent           EventType = "new monitor event"
 	MonitorEventUploaded      EventType = "new event uploaded"
 	MonitorEventRecorded      EventType = "event saved in recordkeeper"
+	RunStateChanged           EventType = "run state changed"
+	MonitorAdded              EventType = "monitor added"
+	MonitorRemoved            EventType = "monitor removed"
+	MonitorConfigChanged      EventType = "monitor configuration changed"
+	MonitorOffline            EventType = "monitor offline"
+	MonitorOnline             EventType = "monitor online"
+	MonitorCaptureStalled     EventType = "monitor capture stalled"
+	MonitorCaptureResumed     EventType = "monitor capture resumed"
+	ZoneminderUnreachable     EventType = "zoneminder unreachable"
+	ZoneminderReachable       EventType = "zoneminder reachable"
+	ZoneminderDaemonStopped   EventType = "zoneminder daemon stopped"
+	ZoneminderDaemonRunning   EventType = "zoneminder daemon running"
+	ZoneminderDiskHigh        EventType = "zoneminder disk usage high"
+	ZoneminderDiskNormal      EventType = "zoneminder disk usage normal"
+	ZoneminderLoadHigh        EventType = "zoneminder load high"
+	ZoneminderLoadNormal      EventType = "zoneminder load normal"
+	ZoneminderLogMatched      EventType = "zoneminder log matched"
+	ActorCrashed              EventType = "actor crashed"
+	ActorRestarted            EventType = "actor restarted"
 )
 
 type Event struct {
 	Type    EventType
 	Payload interface{}
+
+	receipt *receipt
+}
+
+// Ack tells a durable subscription that its handler has finished with the
+// event so that it is not delivered again after a restart. Handlers of other
+// subscriptions may call it freely; it does nothing for them.
+func (s Event) Ack() {
+	if s.receipt != nil {
+		s.receipt.acknowledge()
+	}
+}
+
+func (s Event) sequence() uint64 {
+	if s.receipt == nil {
+		return 0
+	}
+
+	return s.receipt.sequence
 }
 
 type EventHandlerFunc func(eventC <-chan Event, exitC chan struct{})
@@ -24,6 +64,19 @@ type EventDispatch interface {
 }
 
 type SubscriptionManager interface {
-	Register(handler EventHandlerFunc, eventInterests ...EventType)
+	Register(name string, handler EventHandlerFunc, eventInterests ...EventType) SubscriptionID
+	RegisterWithOptions(handler EventHandlerFunc, options SubscriptionOptions, eventInterests ...EventType) (SubscriptionID, error)
+	Unregister(id SubscriptionID) error
+	Pause(id SubscriptionID) error
+	Resume(id SubscriptionID) error
+	Subscriptions() []SubscriptionInfo
+
+	// Replay delivers the events durable subscriptions had not acknowledged
+	// before the last shutdown. The events are delivered in the background, so
+	// events sent afterwards may reach a handler before its backlog does. It is
+	// called once every handler has been registered. Subscriptions registered
+	// later replay right away.
+	Replay()
+
 	EventDispatch
 }
@@ -0,0 +1,137 @@
+package eventserver
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/zinic/forculus/errors"
+)
+
+const (
+	ErrPayloadMismatch = errors.New("event payload mismatch")
+)
+
+var (
+	payloadTypesLock = &sync.RWMutex{}
+	payloadTypes     = make(map[EventType]reflect.Type)
+)
+
+// RegisterPayload records the payload type carried by events of the given
+// types. The reactor rejects events whose payload does not match and uses the
+// registered type to read events back from disk. Packages that dispatch events
+// register their payloads when they are initialized.
+func RegisterPayload(prototype interface{}, eventTypes ...EventType) {
+	payloadTypesLock.Lock()
+	defer payloadTypesLock.Unlock()
+
+	for _, eventType := range eventTypes {
+		payloadTypes[eventType] = reflect.TypeOf(prototype)
+	}
+}
+
+func payloadType(eventType EventType) (reflect.Type, bool) {
+	payloadTypesLock.RLock()
+	defer payloadTypesLock.RUnlock()
+
+	registeredType, registered := payloadTypes[eventType]
+	return registeredType, registered
+}
+
+func describeType(valueType reflect.Type) string {
+	if valueType == nil {
+		return "no payload"
+	}
+
+	return valueType.String()
+}
+
+// ValidatePayload checks that the event carries the payload type registered
+// for its event type
+func ValidatePayload(event Event) error {
+	registeredType, registered := payloadType(event.Type)
+	if !registered {
+		return fmt.Errorf("%w: no payload type registered for event %s", ErrPayloadMismatch, event.Type)
+	}
+
+	if actualType := reflect.TypeOf(event.Payload); actualType != registeredType {
+		return fmt.Errorf("%w: event %s carries %s, expected %s",
+			ErrPayloadMismatch, event.Type, describeType(actualType), describeType(registeredType))
+	}
+
+	return nil
+}
+
+// Decode copies the payload of the event into the value target points to,
+// returning an error instead of panicking when the payload is of another type
+func (s Event) Decode(target interface{}) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() {
+		return fmt.Errorf("payload of event %s can only be decoded into a non-nil pointer", s.Type)
+	}
+
+	var (
+		payloadValue = reflect.ValueOf(s.Payload)
+		targetType   = targetValue.Elem().Type()
+	)
+
+	if !payloadValue.IsValid() || payloadValue.Type() != targetType {
+		return fmt.Errorf("%w: event %s carries %s, decoding into %s",
+			ErrPayloadMismatch, s.Type, describeType(reflect.TypeOf(s.Payload)), describeType(targetType))
+	}
+
+	targetValue.Elem().Set(payloadValue)
+	return nil
+}
+
+// encodedEvent is the form events take on disk. Payloads are gob encoded
+// since the JSON form of some payloads deliberately leaves fields out.
+type encodedEvent struct {
+	Type     EventType `json:"type"`
+	Sequence uint64    `json:"sequence,omitempty"`
+	Payload  []byte    `json:"payload"`
+}
+
+func encodeEvent(event Event) ([]byte, error) {
+	if _, registered := payloadType(event.Type); !registered {
+		return nil, fmt.Errorf("no payload type registered for event %s", event.Type)
+	}
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(event.Payload); err != nil {
+		return nil, fmt.Errorf("failed to encode payload of event %s: %w", event.Type, err)
+	}
+
+	return json.Marshal(encodedEvent{
+		Type:     event.Type,
+		Sequence: event.sequence(),
+		Payload:  payload.Bytes(),
+	})
+}
+
+// decodeEvent restores an event along with the journal sequence it was
+// stored with, if any
+func decodeEvent(content []byte) (Event, uint64, error) {
+	var encoded encodedEvent
+	if err := json.Unmarshal(content, &encoded); err != nil {
+		return Event{}, 0, err
+	}
+
+	registeredType, registered := payloadType(encoded.Type)
+	if !registered {
+		return Event{}, 0, fmt.Errorf("no payload type registered for event %s", encoded.Type)
+	}
+
+	payload := reflect.New(registeredType)
+	if err := gob.NewDecoder(bytes.NewReader(encoded.Payload)).DecodeValue(payload); err != nil {
+		return Event{}, 0, fmt.Errorf("failed to decode payload of event %s: %w", encoded.Type, err)
+	}
+
+	return Event{
+		Type:    encoded.Type,
+		Payload: payload.Elem().Interface(),
+	}, encoded.Sequence, nil
+}
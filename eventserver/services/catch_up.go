@@ -0,0 +1,111 @@
+package services
+
+import (
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/eventserver/statedb"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+const recentEventsWindow = time.Minute * 30
+
+// CatchUp prepares event tracking for a Zoneminder server at startup. Without a
+// stored checkpoint every recent event is marked as seen so that only events
+// created after startup are dispatched. With one, every event created since
+// the checkpoint, bounded by the maximum catch-up window, is replayed through
+// the finalizer.
+func CatchUp(client zmapi.Client, finalizer *EventFinalizer, seenEvents *SeenEvents, database *statedb.Database, cfg config.State, finalizeCfg config.Finalize) error {
+	if database == nil {
+		markRecentEventsSeen(client, seenEvents, nil)
+		return nil
+	}
+
+	checkpoint, err := database.Checkpoint(client.Name())
+	if err == statedb.ErrCheckpointNotFound {
+		log.Infof("No checkpoint stored for %s; skipping catch up", client.Name())
+
+		markRecentEventsSeen(client, seenEvents, database)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	maxCatchUp, err := cfg.MaxCatchUpDuration()
+	if err != nil {
+		return err
+	}
+
+	// Events that were still being finalized when the checkpoint was written
+	// may have started up to the finalizer's maximum wait before it
+	maxWait, err := finalizeCfg.MaxWaitDuration()
+	if err != nil {
+		return err
+	}
+
+	var (
+		end   = time.Now()
+		start = checkpoint.EventTime.Add(-maxWait)
+		floor = end.Add(-maxCatchUp)
+	)
+
+	if start.Before(floor) {
+		log.Warnf("Checkpoint for %s is older than the maximum catch up window of %s; events before %s will not be replayed", client.Name(), maxCatchUp, floor)
+		start = floor
+	}
+
+	log.Infof("Catching up on events from %s since %s", client.Name(), start)
+
+	monitorEvents := listEventsWithRetry(client, start, end)
+
+	replayed := 0
+	for _, monitorEvent := range monitorEvents {
+		if !seenEvents.Seen(monitorEvent.Server, monitorEvent.ID) && finalizer.Observe(monitorEvent) {
+			replayed += 1
+		}
+	}
+
+	log.Infof("Replaying %d events from %s", replayed, client.Name())
+	return nil
+}
+
+func listEventsWithRetry(client zmapi.Client, start, end time.Time) []zmapi.MonitorEvent {
+	for {
+		if monitorEvents, err := client.ListEventsBetween(start, end); err != nil {
+			log.Errorf("Failed to list events from %s: %v", client.Name(), err)
+			time.Sleep(time.Second * 5)
+		} else {
+			return monitorEvents
+		}
+	}
+}
+
+func markRecentEventsSeen(client zmapi.Client, seenEvents *SeenEvents, database *statedb.Database) {
+	var (
+		end   = time.Now()
+		start = end.Add(-recentEventsWindow)
+	)
+
+	log.Infof("Loading most recent events from %s", client.Name())
+
+	checkpoint := statedb.Checkpoint{
+		EventTime: end,
+	}
+
+	for _, monitorEvent := range listEventsWithRetry(client, start, end) {
+		seenEvents.MarkSeen(monitorEvent.Server, monitorEvent.ID)
+
+		if eventID, err := monitorEvent.ParseID(); err == nil && eventID > checkpoint.EventID {
+			checkpoint.EventID = eventID
+		}
+	}
+
+	if database != nil {
+		if err := database.AdvanceCheckpoint(client.Name(), checkpoint); err != nil {
+			log.Errorf("Failed to record checkpoint for %s: %v", client.Name(), err)
+		}
+	}
+
+	log.Infof("Most recent events loaded from %s", client.Name())
+}
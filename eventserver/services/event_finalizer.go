@@ -0,0 +1,243 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+type pendingEvent struct {
+	event       zmapi.MonitorEvent
+	firstSeen   time.Time
+	lastFrames  string
+	stablePolls int
+}
+
+// EventFinalizer holds back events that Zoneminder is still writing. Observed
+// events are announced with MonitorEventStarted right away and dispatched as
+// MonitorNewEvent only once they are closed and their frame count has stopped
+// changing, or once the configured maximum wait has passed.
+type EventFinalizer struct {
+	client     zmapi.Client
+	dispatcher eventserver.EventDispatch
+	seenEvents *SeenEvents
+	cfg        config.Finalize
+	maxWait    time.Duration
+	pending    map[string]*pendingEvent
+	lock       *sync.Mutex
+	exitC      chan struct{}
+
+	// outbox holds the events decided on under the lock until the dispatch
+	// loop sends them, in order and without holding the lock
+	outbox  []eventserver.Event
+	outboxC chan struct{}
+}
+
+func NewEventFinalizer(client zmapi.Client, dispatch eventserver.EventDispatch, seenEvents *SeenEvents, cfg config.Finalize) *EventFinalizer {
+	maxWait, err := cfg.MaxWaitDuration()
+	if err != nil {
+		log.Errorf("Event finalizer for %s has a malformed max wait: %v", client.Name(), err)
+	}
+
+	return &EventFinalizer{
+		client:     client,
+		dispatcher: dispatch,
+		seenEvents: seenEvents,
+		cfg:        cfg,
+		maxWait:    maxWait,
+		pending:    make(map[string]*pendingEvent),
+		lock:       &sync.Mutex{},
+		exitC:      make(chan struct{}),
+		outboxC:    make(chan struct{}, 1),
+	}
+}
+
+// dispatch queues the events collected while holding the lock for the
+// dispatch loop and releases the lock, so that watchers calling Observe are
+// never held up by slow subscriptions
+func (s *EventFinalizer) dispatch(events []eventserver.Event) {
+	if len(events) > 0 {
+		s.outbox = append(s.outbox, events...)
+
+		select {
+		case s.outboxC <- struct{}{}:
+		default:
+		}
+	}
+
+	s.lock.Unlock()
+}
+
+// dispatchLoop sends queued events in the order they were decided on.
+//
+// Finalized events are only persisted as seen once they have been handed to
+// the subscriptions so that a crash in between has them caught up on after a
+// restart. Once handed over, only durable subscriptions are guaranteed to
+// still handle an event if the process stops before their handler gets to it.
+func (s *EventFinalizer) dispatchLoop() {
+	for {
+		select {
+		case <-s.outboxC:
+		case <-s.exitC:
+			return
+		}
+
+		s.lock.Lock()
+		events := s.outbox
+		s.outbox = nil
+		s.lock.Unlock()
+
+		s.send(events)
+	}
+}
+
+func (s *EventFinalizer) send(events []eventserver.Event) {
+	for _, event := range events {
+		s.dispatcher.Send(event)
+
+		var monitorEvent zmapi.MonitorEvent
+		if event.Type != eventserver.MonitorNewEvent {
+			continue
+		} else if err := event.Decode(&monitorEvent); err != nil {
+			log.Errorf("Failed to persist seen state of dispatched event: %v", err)
+		} else {
+			s.seenEvents.Persist(monitorEvent.Server, monitorEvent.ID)
+		}
+	}
+}
+
+// Observe reports an event listed by one of the watchers. It returns true if
+// the event had not been observed before.
+func (s *EventFinalizer) Observe(monitorEvent zmapi.MonitorEvent) bool {
+	s.lock.Lock()
+
+	if s.seenEvents.Seen(monitorEvent.Server, monitorEvent.ID) {
+		s.lock.Unlock()
+		return false
+	}
+
+	var events []eventserver.Event
+
+	pending, tracked := s.pending[monitorEvent.ID]
+	if !tracked {
+		pending = &pendingEvent{
+			firstSeen: time.Now(),
+		}
+
+		s.pending[monitorEvent.ID] = pending
+
+		events = append(events, eventserver.Event{
+			Type:    eventserver.MonitorEventStarted,
+			Payload: monitorEvent,
+		})
+	}
+
+	events = append(events, s.update(pending, monitorEvent)...)
+	s.dispatch(events)
+
+	return !tracked
+}
+
+// update records the latest state of a pending event and returns the events to
+// dispatch if it is now final. The lock must be held.
+func (s *EventFinalizer) update(pending *pendingEvent, monitorEvent zmapi.MonitorEvent) []eventserver.Event {
+	if monitorEvent.Closed() && monitorEvent.Frames == pending.lastFrames {
+		pending.stablePolls += 1
+	} else {
+		pending.stablePolls = 0
+	}
+
+	pending.event = monitorEvent
+	pending.lastFrames = monitorEvent.Frames
+
+	if monitorEvent.Closed() && pending.stablePolls >= s.cfg.StableThreshold() {
+		return s.finalize(pending)
+	} else if s.maxWait > 0 && time.Since(pending.firstSeen) >= s.maxWait {
+		log.Warnf("Event %s on %s was not finalized within %s; dispatching it as is", monitorEvent.ID, monitorEvent.Server, s.maxWait)
+		return s.finalize(pending)
+	}
+
+	return nil
+}
+
+func (s *EventFinalizer) finalize(pending *pendingEvent) []eventserver.Event {
+	delete(s.pending, pending.event.ID)
+
+	if s.seenEvents.Claim(pending.event.Server, pending.event.ID) {
+		return []eventserver.Event{{
+			Type:    eventserver.MonitorNewEvent,
+			Payload: pending.event,
+		}}
+	}
+
+	return nil
+}
+
+// refreshPending fetches the current state of every pending event without
+// holding the lock so that a slow server does not hold up Observe
+func (s *EventFinalizer) refreshPending() {
+	s.lock.Lock()
+
+	pendingIDs := make([]string, 0, len(s.pending))
+	for eventID := range s.pending {
+		pendingIDs = append(pendingIDs, eventID)
+	}
+
+	s.lock.Unlock()
+
+	refreshed := make([]zmapi.MonitorEvent, 0, len(pendingIDs))
+	for _, eventID := range pendingIDs {
+		if monitorEvent, err := s.client.Event(eventID); err != nil {
+			log.Errorf("Failed to refresh pending event %s on %s: %v", eventID, s.client.Name(), err)
+		} else {
+			refreshed = append(refreshed, monitorEvent)
+		}
+	}
+
+	s.lock.Lock()
+
+	var events []eventserver.Event
+	for _, monitorEvent := range refreshed {
+		// The event may have been finalized by Observe in the meantime
+		if pending, tracked := s.pending[monitorEvent.ID]; tracked {
+			events = append(events, s.update(pending, monitorEvent)...)
+		}
+	}
+
+	s.dispatch(events)
+}
+
+func (s *EventFinalizer) finalizeLoop() {
+	pollInterval, err := s.cfg.PollDuration()
+	if err != nil {
+		log.Errorf("Event finalizer for %s has a malformed poll interval: %v", s.client.Name(), err)
+		return
+	}
+
+	loopTicker := time.NewTicker(pollInterval)
+	defer loopTicker.Stop()
+
+	for {
+		select {
+		case <-loopTicker.C:
+			s.refreshPending()
+
+		case <-s.exitC:
+			return
+		}
+	}
+}
+
+func (s *EventFinalizer) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("event finalizer for "+s.client.Name(), s.exitC, s.finalizeLoop)
+	supervisor.Supervise("event dispatch for "+s.client.Name(), s.exitC, s.dispatchLoop)
+}
+
+func (s *EventFinalizer) Stop() {
+	close(s.exitC)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+// EventTail follows the Zoneminder events table by ID and hands every event to
+// the EventFinalizer regardless of the alarm state of its monitor. This catches
+// events from Record and Mocord monitors, externally triggered events and
+// alarms too short to be seen by the MonitorWatch.
+type EventTail struct {
+	client    zmapi.Client
+	finalizer *EventFinalizer
+	cfg       config.EventTail
+	exitC     chan struct{}
+
+	lastEventID int64
+}
+
+func NewEventTail(client zmapi.Client, finalizer *EventFinalizer, cfg config.EventTail) service.Service {
+	return &EventTail{
+		client:    client,
+		finalizer: finalizer,
+		cfg:       cfg,
+		exitC:     make(chan struct{}),
+	}
+}
+
+// loadStartingPoint positions the tail at the newest event on the server so
+// that it only follows events created after startup. Anything older has
+// already been handled by CatchUp. Tailing does not start until the newest
+// event is known since starting from zero would replay the server's entire
+// history.
+func (s *EventTail) loadStartingPoint() bool {
+	latestEventID, err := s.client.LatestEventID()
+	if err != nil {
+		log.Errorf("Failed to load the newest event ID from %s; event tail will not start until it is known: %v", s.client.Name(), err)
+		return false
+	}
+
+	s.lastEventID = latestEventID
+
+	var (
+		end   = time.Now()
+		start = end.Add(-recentEventsWindow)
+	)
+
+	// Recent events may still be in progress so they are handed to the
+	// finalizer, which dispatches them once they close unless already seen
+	if monitorEvents, err := s.client.ListEventsBetween(start, end); err != nil {
+		log.Errorf("Failed to load most recent events from %s: %v", s.client.Name(), err)
+	} else {
+		for _, monitorEvent := range monitorEvents {
+			if eventID, err := monitorEvent.ParseID(); err == nil && eventID <= s.lastEventID {
+				s.finalizer.Observe(monitorEvent)
+			}
+		}
+	}
+
+	log.Infof("Tailing events from %s after event %d", s.client.Name(), s.lastEventID)
+	return true
+}
+
+func (s *EventTail) poll() {
+	monitorEvents, err := s.client.ListEventsAfter(s.lastEventID)
+	if err != nil {
+		log.Errorf("Failed to list new events from %s: %v", s.client.Name(), err)
+		return
+	}
+
+	for _, monitorEvent := range monitorEvents {
+		if eventID, err := monitorEvent.ParseID(); err != nil {
+			log.Errorf("Failed to parse ID of event %s from %s: %v", monitorEvent.ID, s.client.Name(), err)
+			continue
+		} else if eventID > s.lastEventID {
+			s.lastEventID = eventID
+		}
+
+		s.finalizer.Observe(monitorEvent)
+	}
+}
+
+func (s *EventTail) tailLoop() {
+	pollInterval, err := s.cfg.PollDuration()
+	if err != nil {
+		log.Errorf("Event tail for %s has a malformed poll interval: %v", s.client.Name(), err)
+		return
+	}
+
+	loopTicker := time.NewTicker(pollInterval)
+	defer loopTicker.Stop()
+
+	initialized := s.loadStartingPoint()
+
+	for {
+		select {
+		case <-loopTicker.C:
+			if !initialized {
+				initialized = s.loadStartingPoint()
+			} else {
+				s.poll()
+			}
+
+		case <-s.exitC:
+			return
+		}
+	}
+}
+
+func (s *EventTail) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("event tail for "+s.client.Name(), s.exitC, s.tailLoop)
+}
+
+func (s *EventTail) Stop() {
+	close(s.exitC)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+type HostHealthWatch struct {
+	client     zmapi.Client
+	dispatcher eventserver.EventDispatch
+	cfg        config.Health
+	exitC      chan struct{}
+
+	unreachable     bool
+	daemonStopped   bool
+	diskHigh        bool
+	loadHigh        bool
+	offlineMonitors map[string]bool
+	stalledMonitors map[string]bool
+	stalledPolls    map[string]int
+
+	// Checks the server can not support are only reported once
+	diskUnsupportedLogged     bool
+	monitorsUnsupportedLogged bool
+}
+
+func NewHostHealthWatch(client zmapi.Client, dispatch eventserver.EventDispatch, cfg config.Health) service.Service {
+	return &HostHealthWatch{
+		client:          client,
+		dispatcher:      dispatch,
+		cfg:             cfg,
+		exitC:           make(chan struct{}),
+		offlineMonitors: make(map[string]bool),
+		stalledMonitors: make(map[string]bool),
+		stalledPolls:    make(map[string]int),
+	}
+}
+
+// transition dispatches the high or recovery event when a tracked condition
+// changes and records the new state of the condition
+func (s *HostHealthWatch) transition(current *bool, next bool, raised, recovered eventserver.EventType, payload interface{}) {
+	if *current == next {
+		return
+	}
+
+	*current = next
+
+	eventType := recovered
+	if next {
+		eventType = raised
+	}
+
+	s.dispatcher.Send(eventserver.Event{
+		Type:    eventType,
+		Payload: payload,
+	})
+}
+
+func (s *HostHealthWatch) hostPayload(detail string, value float64) HostHealthPayload {
+	return HostHealthPayload{
+		Server: s.client.Name(),
+		Detail: detail,
+		Value:  value,
+	}
+}
+
+// diskUsagePercent prefers the used and total space of the storage areas since
+// getDiskPercent only reports a percentage on releases before 1.32
+func (s *HostHealthWatch) diskUsagePercent() (float64, error) {
+	if storageAreas, err := s.client.StorageAreas(); err != nil {
+		log.Debugf("Failed to list storage areas of %s: %v", s.client.Name(), err)
+	} else if usagePercent, reported := storageAreas.UsagePercent(); reported {
+		return usagePercent, nil
+	}
+
+	if diskPercent, err := s.client.HostDiskPercent(); err != nil {
+		return 0, err
+	} else {
+		return diskPercent.TotalPercent()
+	}
+}
+
+func (s *HostHealthWatch) checkHost() bool {
+	if daemonCheck, err := s.client.DaemonCheck(); err != nil {
+		log.Errorf("Zoneminder %s health check failed: %v", s.client.Name(), err)
+
+		s.transition(&s.unreachable, true, eventserver.ZoneminderUnreachable, eventserver.ZoneminderReachable,
+			s.hostPayload(err.Error(), 0))
+		return false
+	} else {
+		s.transition(&s.unreachable, false, eventserver.ZoneminderUnreachable, eventserver.ZoneminderReachable,
+			s.hostPayload("zoneminder API is responding", 0))
+
+		s.transition(&s.daemonStopped, !daemonCheck.Running(), eventserver.ZoneminderDaemonStopped, eventserver.ZoneminderDaemonRunning,
+			s.hostPayload(fmt.Sprintf("daemon check returned %d", daemonCheck.Result), float64(daemonCheck.Result)))
+	}
+
+	if totalPercent, err := s.diskUsagePercent(); err == zmapi.ErrDiskPercentUnavailable {
+		if !s.diskUnsupportedLogged {
+			log.Warnf("Zoneminder %s reports neither a disk usage percentage nor the total space of its storage areas; disk usage will not be checked", s.client.Name())
+			s.diskUnsupportedLogged = true
+		}
+	} else if err != nil {
+		log.Errorf("Failed to check disk usage for %s: %v", s.client.Name(), err)
+	} else {
+		threshold := s.cfg.DiskThreshold()
+
+		s.transition(&s.diskHigh, totalPercent >= threshold, eventserver.ZoneminderDiskHigh, eventserver.ZoneminderDiskNormal,
+			s.hostPayload(fmt.Sprintf("disk usage at %.1f%% with a threshold of %.1f%%", totalPercent, threshold), totalPercent))
+	}
+
+	if s.cfg.LoadHigh > 0 {
+		if hostLoad, err := s.client.HostLoad(); err != nil {
+			log.Errorf("Failed to check load for %s: %v", s.client.Name(), err)
+		} else {
+			load := hostLoad.OneMinute()
+
+			s.transition(&s.loadHigh, load >= s.cfg.LoadHigh, eventserver.ZoneminderLoadHigh, eventserver.ZoneminderLoadNormal,
+				s.hostPayload(fmt.Sprintf("load average at %.2f with a threshold of %.2f", load, s.cfg.LoadHigh), load))
+		}
+	}
+
+	return true
+}
+
+func (s *HostHealthWatch) checkMonitors() {
+	if report, err := s.client.CheckCompatibility(); err != nil {
+		return
+	} else if !report.MonitorStatus {
+		if !s.monitorsUnsupportedLogged {
+			log.Warnf("Zoneminder %s (%s) does not report monitor status; monitor health will not be checked", s.client.Name(), report.ServerVersion)
+			s.monitorsUnsupportedLogged = true
+		}
+
+		return
+	}
+
+	monitors, err := s.client.Monitors()
+	if err != nil {
+		log.Errorf("Failed to list monitors for %s: %v", s.client.Name(), err)
+		return
+	}
+
+	activeMonitors := make(map[string]struct{}, len(monitors))
+
+	for _, monitor := range monitors {
+		if !monitor.Active() {
+			continue
+		}
+
+		var (
+			monitorID = monitor.Details.ID
+			offline   = s.offlineMonitors[monitorID]
+			stalled   = s.stalledMonitors[monitorID]
+		)
+
+		activeMonitors[monitorID] = struct{}{}
+
+		s.transition(&offline, !monitor.Connected(), eventserver.MonitorOffline, eventserver.MonitorOnline, MonitorHealthPayload{
+			Monitor: monitor,
+			Detail:  fmt.Sprintf("monitor status is %s", monitor.Status.State),
+		})
+
+		if captureFPS, err := monitor.ParseCaptureFPS(); err != nil || offline || captureFPS > 0 {
+			s.stalledPolls[monitorID] = 0
+		} else {
+			s.stalledPolls[monitorID] += 1
+		}
+
+		s.transition(&stalled, s.stalledPolls[monitorID] >= s.cfg.StalledThreshold(), eventserver.MonitorCaptureStalled, eventserver.MonitorCaptureResumed, MonitorHealthPayload{
+			Monitor: monitor,
+			Detail:  fmt.Sprintf("capture FPS is %s", monitor.Status.CaptureFPS),
+		})
+
+		s.offlineMonitors[monitorID] = offline
+		s.stalledMonitors[monitorID] = stalled
+	}
+
+	// Forget monitors that were removed or disabled
+	for monitorID := range s.offlineMonitors {
+		if _, active := activeMonitors[monitorID]; !active {
+			delete(s.offlineMonitors, monitorID)
+			delete(s.stalledMonitors, monitorID)
+			delete(s.stalledPolls, monitorID)
+		}
+	}
+}
+
+func (s *HostHealthWatch) healthWatchLoop() {
+	pollInterval, err := s.cfg.PollDuration()
+	if err != nil {
+		log.Errorf("Health watch for %s has a malformed poll interval: %v", s.client.Name(), err)
+		return
+	}
+
+	loopTicker := time.NewTicker(pollInterval)
+	defer loopTicker.Stop()
+
+	log.Infof("Beginning health watch for %s", s.client.Name())
+
+	for {
+		if s.checkHost() {
+			s.checkMonitors()
+		}
+
+		select {
+		case <-loopTicker.C:
+		case <-s.exitC:
+			return
+		}
+	}
+}
+
+func (s *HostHealthWatch) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("host health watch for "+s.client.Name(), s.exitC, s.healthWatchLoop)
+}
+
+func (s *HostHealthWatch) Stop() {
+	close(s.exitC)
+}
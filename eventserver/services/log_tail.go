@@ -0,0 +1,220 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+type logPattern struct {
+	name     string
+	regex    *regexp.Regexp
+	cooldown time.Duration
+	cfg      config.LogPattern
+}
+
+// LogTail follows Zoneminder's own log and dispatches an event for every line
+// that matches one of the configured patterns
+type LogTail struct {
+	client     zmapi.Client
+	dispatcher eventserver.EventDispatch
+	cfg        config.LogTail
+	patterns   []logPattern
+	exitC      chan struct{}
+
+	primed      bool
+	cursor      float64
+	cursorKeys  map[string]struct{}
+	lastMatches map[string]time.Time
+}
+
+func NewLogTail(client zmapi.Client, dispatch eventserver.EventDispatch, cfg config.LogTail) (*LogTail, error) {
+	patterns := make([]logPattern, 0, len(cfg.Patterns))
+
+	for name, patternCfg := range cfg.Patterns {
+		if regex, err := patternCfg.Regex(); err != nil {
+			return nil, fmt.Errorf("log pattern %s for %s is malformed: %w", name, client.Name(), err)
+		} else if cooldown, err := patternCfg.CooldownDuration(); err != nil {
+			return nil, fmt.Errorf("log pattern %s for %s has a malformed cooldown: %w", name, client.Name(), err)
+		} else {
+			patterns = append(patterns, logPattern{
+				name:     name,
+				regex:    regex,
+				cooldown: cooldown,
+				cfg:      patternCfg,
+			})
+		}
+	}
+
+	// Keep matching order stable between runs
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].name < patterns[j].name
+	})
+
+	return &LogTail{
+		client:      client,
+		dispatcher:  dispatch,
+		cfg:         cfg,
+		patterns:    patterns,
+		exitC:       make(chan struct{}),
+		cursorKeys:  make(map[string]struct{}),
+		lastMatches: make(map[string]time.Time),
+	}, nil
+}
+
+type timedLogEntry struct {
+	entry   zmapi.LogEntry
+	timeKey float64
+}
+
+// newEntries pages through the log from the newest line until it reaches the
+// cursor and returns the unseen lines, newest first
+func (s *LogTail) newEntries() ([]timedLogEntry, error) {
+	var entries []timedLogEntry
+
+	for page := 1; page <= s.cfg.PageLimit(); page++ {
+		logPage, err := s.client.Logs(page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range logPage.Entries {
+			timeKey, err := strconv.ParseFloat(entry.TimeKey.String(), 64)
+			if err != nil {
+				log.Debugf("Skipping log line on %s with malformed time key %q", s.client.Name(), entry.TimeKey)
+				continue
+			}
+
+			if s.primed {
+				if timeKey < s.cursor {
+					return entries, nil
+				} else if _, seen := s.cursorKeys[entry.Key()]; timeKey == s.cursor && seen {
+					continue
+				}
+			}
+
+			entries = append(entries, timedLogEntry{
+				entry:   entry,
+				timeKey: timeKey,
+			})
+
+			// The first read only positions the cursor at the newest line
+			if !s.primed {
+				return entries, nil
+			}
+		}
+
+		if !logPage.NextPage {
+			return entries, nil
+		}
+	}
+
+	log.Warnf("Log tail for %s read %d pages without reaching previously seen lines; older lines were skipped",
+		s.client.Name(), s.cfg.PageLimit())
+
+	return entries, nil
+}
+
+func (s *LogTail) advanceCursor(entries []timedLogEntry) {
+	for _, entry := range entries {
+		if entry.timeKey > s.cursor {
+			s.cursor = entry.timeKey
+			s.cursorKeys = make(map[string]struct{})
+		}
+
+		if entry.timeKey == s.cursor {
+			s.cursorKeys[entry.entry.Key()] = struct{}{}
+		}
+	}
+}
+
+func (s *LogTail) match(entry zmapi.LogEntry) {
+	for _, pattern := range s.patterns {
+		if !pattern.cfg.AcceptsComponent(entry.Component) || !pattern.cfg.AcceptsLevel(entry.Code) || !pattern.regex.MatchString(entry.Message) {
+			continue
+		}
+
+		entryTime, err := entry.Time()
+		if err != nil {
+			log.Debugf("Log line on %s has a malformed time key %q: %v", s.client.Name(), entry.TimeKey, err)
+			entryTime = time.Now()
+		}
+
+		// A failing daemon repeats the same line until it recovers so further
+		// matches from the same component are held back for the cooldown
+		cooldownKey := pattern.name + "/" + entry.Component
+		if lastMatch, matched := s.lastMatches[cooldownKey]; matched && entryTime.Sub(lastMatch) < pattern.cooldown {
+			continue
+		}
+
+		s.lastMatches[cooldownKey] = entryTime
+
+		s.dispatcher.Send(eventserver.Event{
+			Type: eventserver.ZoneminderLogMatched,
+			Payload: LogMatchedPayload{
+				Server:    s.client.Name(),
+				Pattern:   pattern.name,
+				MonitorID: entry.MonitorID(),
+				Time:      entryTime,
+				Entry:     entry,
+			},
+		})
+	}
+}
+
+func (s *LogTail) poll() {
+	entries, err := s.newEntries()
+	if err != nil {
+		log.Errorf("Failed to read logs from %s: %v", s.client.Name(), err)
+		return
+	}
+
+	if s.primed {
+		// Match in the order the lines were written
+		for idx := len(entries) - 1; idx >= 0; idx-- {
+			s.match(entries[idx].entry)
+		}
+	}
+
+	s.advanceCursor(entries)
+	s.primed = true
+}
+
+func (s *LogTail) logTailLoop() {
+	pollInterval, err := s.cfg.PollDuration()
+	if err != nil {
+		log.Errorf("Log tail for %s has a malformed poll interval: %v", s.client.Name(), err)
+		return
+	}
+
+	log.Infof("Beginning log tail for %s with %d patterns", s.client.Name(), len(s.patterns))
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.poll()
+
+		select {
+		case <-ticker.C:
+		case <-s.exitC:
+			return
+		}
+	}
+}
+
+func (s *LogTail) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("log tail for "+s.client.Name(), s.exitC, s.logTailLoop)
+}
+
+func (s *LogTail) Stop() {
+	close(s.exitC)
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"time"
+
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+func init() {
+	eventserver.RegisterPayload(zmapi.AlertedMonitor{},
+		eventserver.MonitorAlerted, eventserver.MonitorAlertStatusChanged, eventserver.MonitorExitingAlert)
+
+	eventserver.RegisterPayload(zmapi.MonitorEvent{},
+		eventserver.MonitorEventStarted, eventserver.MonitorNewEvent)
+
+	eventserver.RegisterPayload(RunStateChangedPayload{}, eventserver.RunStateChanged)
+
+	eventserver.RegisterPayload(MonitorChangedPayload{},
+		eventserver.MonitorAdded, eventserver.MonitorRemoved, eventserver.MonitorConfigChanged)
+
+	eventserver.RegisterPayload(MonitorHealthPayload{},
+		eventserver.MonitorOffline, eventserver.MonitorOnline,
+		eventserver.MonitorCaptureStalled, eventserver.MonitorCaptureResumed)
+
+	eventserver.RegisterPayload(HostHealthPayload{},
+		eventserver.ZoneminderUnreachable, eventserver.ZoneminderReachable,
+		eventserver.ZoneminderDaemonStopped, eventserver.ZoneminderDaemonRunning,
+		eventserver.ZoneminderDiskHigh, eventserver.ZoneminderDiskNormal,
+		eventserver.ZoneminderLoadHigh, eventserver.ZoneminderLoadNormal)
+
+	eventserver.RegisterPayload(LogMatchedPayload{}, eventserver.ZoneminderLogMatched)
+}
+
+type RunStateChangedPayload struct {
+	Server   string
+	Previous string
+	Current  string
+	Trigger  string
+}
+
+type HostHealthPayload struct {
+	Server string
+	Detail string
+	Value  float64
+}
+
+type MonitorHealthPayload struct {
+	Monitor zmapi.Monitor
+	Detail  string
+}
+
+type MonitorChangedPayload struct {
+	Monitor  zmapi.Monitor
+	Previous zmapi.Monitor
+	Changes  []string
+}
+
+type LogMatchedPayload struct {
+	Server    string
+	Pattern   string
+	MonitorID string
+	Time      time.Time
+	Entry     zmapi.LogEntry
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+// MonitorInventory caches the monitor list of a Zoneminder server and refreshes
+// it on a slow interval, dispatching an event for every monitor that was
+// added, removed or reconfigured since the last refresh
+type MonitorInventory struct {
+	client     zmapi.Client
+	dispatcher eventserver.EventDispatch
+	cfg        config.Inventory
+	monitors   map[string]zmapi.Monitor
+	loaded     bool
+	lock       *sync.RWMutex
+	exitC      chan struct{}
+}
+
+func NewMonitorInventory(client zmapi.Client, dispatch eventserver.EventDispatch, cfg config.Inventory) *MonitorInventory {
+	return &MonitorInventory{
+		client:     client,
+		dispatcher: dispatch,
+		cfg:        cfg,
+		monitors:   make(map[string]zmapi.Monitor),
+		lock:       &sync.RWMutex{},
+		exitC:      make(chan struct{}),
+	}
+}
+
+func monitorChanges(monitor, previous zmapi.Monitor) []string {
+	changes := monitor.Details.ConfigChanges(previous.Details)
+
+	if !reflect.DeepEqual(monitor.Groups, previous.Groups) {
+		changes = append(changes, "Groups")
+	}
+
+	return changes
+}
+
+// diff returns the change events between the cached monitors and the given
+// ones. The lock must be held.
+func (s *MonitorInventory) diff(monitors map[string]zmapi.Monitor) []eventserver.Event {
+	var events []eventserver.Event
+
+	for monitorID, monitor := range monitors {
+		if previous, known := s.monitors[monitorID]; !known {
+			events = append(events, eventserver.Event{
+				Type: eventserver.MonitorAdded,
+				Payload: MonitorChangedPayload{
+					Monitor: monitor,
+				},
+			})
+		} else if changes := monitorChanges(monitor, previous); len(changes) > 0 {
+			log.Debugf("Monitor %s on %s changed: %s", monitor.Name(), s.client.Name(), strings.Join(changes, ", "))
+
+			events = append(events, eventserver.Event{
+				Type: eventserver.MonitorConfigChanged,
+				Payload: MonitorChangedPayload{
+					Monitor:  monitor,
+					Previous: previous,
+					Changes:  changes,
+				},
+			})
+		}
+	}
+
+	for monitorID, previous := range s.monitors {
+		if _, stillPresent := monitors[monitorID]; !stillPresent {
+			events = append(events, eventserver.Event{
+				Type: eventserver.MonitorRemoved,
+				Payload: MonitorChangedPayload{
+					Monitor:  previous,
+					Previous: previous,
+				},
+			})
+		}
+	}
+
+	return events
+}
+
+// Refresh reloads the monitor list from Zoneminder. Change events are only
+// dispatched once an initial list has been loaded, and only after the lock has
+// been released so that slow subscriptions do not hold up Monitors.
+func (s *MonitorInventory) Refresh() error {
+	monitorList, err := s.client.Monitors()
+	if err != nil {
+		return err
+	}
+
+	monitors := make(map[string]zmapi.Monitor, len(monitorList))
+	for _, monitor := range monitorList {
+		monitors[monitor.Details.ID] = monitor
+	}
+
+	var events []eventserver.Event
+
+	s.lock.Lock()
+
+	if s.loaded {
+		events = s.diff(monitors)
+	}
+
+	s.monitors = monitors
+	s.loaded = true
+
+	s.lock.Unlock()
+
+	for _, event := range events {
+		s.dispatcher.Send(event)
+	}
+
+	return nil
+}
+
+// Monitors returns the cached monitor list ordered by monitor ID, loading it
+// first if needed
+func (s *MonitorInventory) Monitors() (zmapi.MonitorList, error) {
+	s.lock.RLock()
+	loaded := s.loaded
+	s.lock.RUnlock()
+
+	if !loaded {
+		if err := s.Refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	monitors := make(zmapi.MonitorList, 0, len(s.monitors))
+	for _, monitor := range s.monitors {
+		monitors = append(monitors, monitor)
+	}
+
+	// Monitor IDs are numeric so shorter IDs sort first
+	sort.Slice(monitors, func(i, j int) bool {
+		if left, right := monitors[i].Details.ID, monitors[j].Details.ID; len(left) != len(right) {
+			return len(left) < len(right)
+		} else {
+			return left < right
+		}
+	})
+
+	return monitors, nil
+}
+
+func (s *MonitorInventory) refreshLoop() {
+	refreshInterval, err := s.cfg.RefreshDuration()
+	if err != nil {
+		log.Errorf("Monitor inventory for %s has a malformed refresh interval: %v", s.client.Name(), err)
+		return
+	}
+
+	loopTicker := time.NewTicker(refreshInterval)
+	defer loopTicker.Stop()
+
+	for {
+		select {
+		case <-loopTicker.C:
+			if err := s.Refresh(); err != nil {
+				log.Errorf("Failed to refresh monitor inventory for %s: %v", s.client.Name(), err)
+			}
+
+		case <-s.exitC:
+			return
+		}
+	}
+}
+
+func (s *MonitorInventory) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("monitor inventory for "+s.client.Name(), s.exitC, s.refreshLoop)
+}
+
+func (s *MonitorInventory) Stop() {
+	close(s.exitC)
+}
@@ -1,9 +1,9 @@
 package services
 
 import (
-	"sync"
 	"time"
 
+	"github.com/zinic/forculus/config"
 	"github.com/zinic/forculus/eventserver"
 	"github.com/zinic/forculus/service"
 
@@ -14,89 +14,102 @@ import (
 
 type MonitorWatch struct {
 	client     zmapi.Client
+	inventory  *MonitorInventory
 	dispatcher eventserver.EventDispatch
+	cadence    *PollCadence
+	cfg        config.Inventory
 	exitC      chan struct{}
 }
 
-func NewMonitorWatch(client zmapi.Client, dispatch eventserver.EventDispatch) service.Service {
+func NewMonitorWatch(client zmapi.Client, inventory *MonitorInventory, cadence *PollCadence, dispatch eventserver.EventDispatch, cfg config.Inventory) service.Service {
 	return &MonitorWatch{
 		client:     client,
+		inventory:  inventory,
+		cadence:    cadence,
 		dispatcher: dispatch,
+		cfg:        cfg,
 		exitC:      make(chan struct{}),
 	}
 }
 
-func (s *MonitorWatch) monitorWatchLoop() {
-	const (
-		scanInterval = time.Second * 2
-	)
+// alertedMonitors polls the alarm status of every cached monitor
+func (s *MonitorWatch) alertedMonitors() (map[string]zmapi.AlertedMonitor, []error) {
+	if monitors, err := s.inventory.Monitors(); err != nil {
+		return nil, []error{err}
+	} else {
+		return s.client.AlertedMonitors(monitors, s.cfg.Workers())
+	}
+}
+
+func (s *MonitorWatch) dispatchChanges(watchedMonitors, alertedMonitors map[string]zmapi.AlertedMonitor) {
+	for monitorID, alertedMonitor := range alertedMonitors {
+		if lastWatch, watching := watchedMonitors[monitorID]; !watching {
+			watchedMonitors[monitorID] = alertedMonitor
+
+			s.dispatcher.Send(eventserver.Event{
+				Type:    eventserver.MonitorAlerted,
+				Payload: alertedMonitor,
+			})
+		} else if lastWatch.AlarmStatus != alertedMonitor.AlarmStatus {
+			watchedMonitors[monitorID] = alertedMonitor
+
+			s.dispatcher.Send(eventserver.Event{
+				Type:    eventserver.MonitorAlertStatusChanged,
+				Payload: alertedMonitor,
+			})
+		}
+	}
 
-	var (
-		loopTicker      = time.NewTicker(scanInterval)
-		watchedMonitors = make(map[string]zmapi.AlertedMonitor)
-	)
+	for monitorID, watchedMonitor := range watchedMonitors {
+		if _, stillAlerted := alertedMonitors[monitorID]; !stillAlerted {
+			delete(watchedMonitors, monitorID)
 
-	defer loopTicker.Stop()
+			s.dispatcher.Send(eventserver.Event{
+				Type:    eventserver.MonitorExitingAlert,
+				Payload: watchedMonitor,
+			})
+		}
+	}
+}
 
-	log.Info("Beginning monitor watch")
+func (s *MonitorWatch) monitorWatchLoop() {
+	watchedMonitors := make(map[string]zmapi.AlertedMonitor)
+
+	log.Infof("Beginning monitor watch for %s", s.client.Name())
 
 	for done := false; !done; {
-		alertedMonitors, errList := s.client.AlertedMonitors()
+		scanStart := time.Now()
+		alertedMonitors, errList := s.alertedMonitors()
+		s.cadence.ObserveScan(time.Since(scanStart))
 
 		// Capture the errors that may have occurred while enumerating the alert status
-		// of our watched monitors
+		// of our watched monitors and wait for the next scan rather than act on a
+		// partial result
 		if errList != nil {
 			for _, err := range errList {
-				log.Errorf("Error during alerted monitor enumeration: %v", err)
+				log.Errorf("Error during alerted monitor enumeration for %s: %v", s.client.Name(), err)
 			}
-
-			continue
-		}
-
-		for monitorID, alertedMonitor := range alertedMonitors {
-			if lastWatch, watching := watchedMonitors[monitorID]; !watching {
-				watchedMonitors[monitorID] = alertedMonitor
-
-				s.dispatcher.Send(eventserver.Event{
-					Type:    eventserver.MonitorAlerted,
-					Payload: alertedMonitor,
-				})
-			} else if lastWatch.AlarmStatus != alertedMonitor.AlarmStatus {
-				watchedMonitors[monitorID] = alertedMonitor
-
-				s.dispatcher.Send(eventserver.Event{
-					Type:    eventserver.MonitorAlertStatusChanged,
-					Payload: alertedMonitor,
-				})
+		} else {
+			if len(alertedMonitors) > 0 {
+				s.cadence.ObserveAlarm()
 			}
-		}
 
-		for monitorID, watchedMonitor := range watchedMonitors {
-			if _, stillAlerted := alertedMonitors[monitorID]; !stillAlerted {
-				delete(watchedMonitors, monitorID)
-
-				s.dispatcher.Send(eventserver.Event{
-					Type:    eventserver.MonitorExitingAlert,
-					Payload: watchedMonitor,
-				})
-			}
+			s.dispatchChanges(watchedMonitors, alertedMonitors)
 		}
 
+		scanTimer := time.NewTimer(s.cadence.Interval())
+
 		select {
-		case <-loopTicker.C:
+		case <-scanTimer.C:
 		case <-s.exitC:
+			scanTimer.Stop()
 			done = true
 		}
 	}
 }
 
-func (s *MonitorWatch) Start(waitGroup *sync.WaitGroup) {
-	waitGroup.Add(1)
-
-	go func() {
-		s.monitorWatchLoop()
-		waitGroup.Done()
-	}()
+func (s *MonitorWatch) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("monitor watch for "+s.client.Name(), s.exitC, s.monitorWatchLoop)
 }
 
 func (s *MonitorWatch) Stop() {
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/log"
+)
+
+type PollMode string
+
+const (
+	PollModeFast    PollMode = "fast"
+	PollModeIdle    PollMode = "idle"
+	PollModeBackoff PollMode = "backoff"
+
+	// scanTimeWeight is the weight of the newest sample in the moving average
+	// of scan times
+	scanTimeWeight = 0.3
+)
+
+type PollStatus struct {
+	Server    string     `json:"server"`
+	Mode      PollMode   `json:"mode"`
+	Interval  string     `json:"interval"`
+	ScanTime  string     `json:"scan_time"`
+	LastAlarm *time.Time `json:"last_alarm,omitempty"`
+}
+
+// PollCadence decides how often the watchers of a Zoneminder server poll. It
+// polls fast while a monitor is or was recently alarmed, slows down when
+// everything is idle and backs off in proportion to the scan time when the
+// server responds slowly.
+type PollCadence struct {
+	server   string
+	fast     time.Duration
+	idle     time.Duration
+	cooldown time.Duration
+	max      time.Duration
+	slowScan time.Duration
+
+	lastAlarm time.Time
+	scanTime  time.Duration
+	mode      PollMode
+	interval  time.Duration
+	lock      *sync.Mutex
+}
+
+func NewPollCadence(server string, cfg config.Polling) (*PollCadence, error) {
+	cadence := &PollCadence{
+		server: server,
+		lock:   &sync.Mutex{},
+	}
+
+	var err error
+	if cadence.fast, err = cfg.FastDuration(); err != nil {
+		return nil, err
+	} else if cadence.idle, err = cfg.IdleDuration(); err != nil {
+		return nil, err
+	} else if cadence.cooldown, err = cfg.CooldownDuration(); err != nil {
+		return nil, err
+	} else if cadence.max, err = cfg.MaxDuration(); err != nil {
+		return nil, err
+	} else if cadence.slowScan, err = cfg.SlowScanDuration(); err != nil {
+		return nil, err
+	}
+
+	return cadence, nil
+}
+
+// ObserveScan records how long a full poll of the server took
+func (s *PollCadence) ObserveScan(scanTime time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.scanTime == 0 {
+		s.scanTime = scanTime
+	} else {
+		s.scanTime = time.Duration(float64(s.scanTime)*(1-scanTimeWeight) + float64(scanTime)*scanTimeWeight)
+	}
+}
+
+// ObserveAlarm records that a monitor is alarmed
+func (s *PollCadence) ObserveAlarm() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastAlarm = time.Now()
+}
+
+func (s *PollCadence) evaluate() (PollMode, time.Duration) {
+	mode, interval := PollModeIdle, s.idle
+	if !s.lastAlarm.IsZero() && time.Since(s.lastAlarm) < s.cooldown {
+		mode, interval = PollModeFast, s.fast
+	}
+
+	if s.slowScan > 0 && s.scanTime > s.slowScan {
+		mode = PollModeBackoff
+		interval = time.Duration(float64(interval) * float64(s.scanTime) / float64(s.slowScan))
+
+		if interval > s.max {
+			interval = s.max
+		}
+	}
+
+	return mode, interval.Round(time.Millisecond * 100)
+}
+
+// Interval returns the time to wait before the next poll, logging whenever the
+// mode changes. The backoff interval follows the scan time and changes on
+// almost every poll, so changes within a mode are only logged for debugging.
+func (s *PollCadence) Interval() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	mode, interval := s.evaluate()
+	if mode != s.mode {
+		if mode == PollModeBackoff {
+			log.Warnf("Polling %s every %s in %s mode; scans are taking %s", s.server, interval, mode, s.scanTime.Round(time.Millisecond))
+		} else {
+			log.Infof("Polling %s every %s in %s mode", s.server, interval, mode)
+		}
+	} else if interval != s.interval {
+		log.Debugf("Polling %s every %s in %s mode; scans are taking %s", s.server, interval, mode, s.scanTime.Round(time.Millisecond))
+	}
+
+	s.mode, s.interval = mode, interval
+	return interval
+}
+
+func (s *PollCadence) Status() PollStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	mode, interval := s.evaluate()
+	status := PollStatus{
+		Server:   s.server,
+		Mode:     mode,
+		Interval: interval.String(),
+		ScanTime: s.scanTime.Round(time.Millisecond).String(),
+	}
+
+	if !s.lastAlarm.IsZero() {
+		lastAlarm := s.lastAlarm
+		status.LastAlarm = &lastAlarm
+	}
+
+	return status
+}
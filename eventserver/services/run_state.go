@@ -0,0 +1,77 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/zinic/forculus/eventserver"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+type RunStateControl struct {
+	client     zmapi.Client
+	dispatcher eventserver.EventDispatch
+	lock       *sync.Mutex
+}
+
+func NewRunStateControl(client zmapi.Client, dispatch eventserver.EventDispatch) *RunStateControl {
+	return &RunStateControl{
+		client:     client,
+		dispatcher: dispatch,
+		lock:       &sync.Mutex{},
+	}
+}
+
+func (s *RunStateControl) States() (zmapi.RunStateList, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.client.RunStates()
+}
+
+func (s *RunStateControl) activeStateName() string {
+	if runStates, err := s.client.RunStates(); err != nil {
+		log.Warnf("Unable to determine the active run state: %v", err)
+	} else if activeState, hasActive := runStates.Active(); hasActive {
+		return activeState.Name
+	}
+
+	return ""
+}
+
+func (s *RunStateControl) Change(name, trigger string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous := s.activeStateName()
+
+	if err := s.client.ChangeRunState(name); err != nil {
+		return err
+	}
+
+	log.Infof("Run state for %s changed from %s to %s by %s", s.client.Name(), previous, name, trigger)
+
+	s.dispatcher.Send(eventserver.Event{
+		Type: eventserver.RunStateChanged,
+		Payload: RunStateChangedPayload{
+			Server:   s.client.Name(),
+			Previous: previous,
+			Current:  name,
+			Trigger:  trigger,
+		},
+	})
+
+	return nil
+}
+
+func (s *RunStateControl) ControlDaemons(command zmapi.DaemonCommand, trigger string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.client.ControlDaemons(command); err != nil {
+		return err
+	}
+
+	log.Infof("Zoneminder daemon %s for %s requested by %s", command, s.client.Name(), trigger)
+	return nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+)
+
+type RunStateSchedule struct {
+	controls  map[string]*RunStateControl
+	schedules map[string]config.RunStateSchedule
+	exitC     chan struct{}
+}
+
+func NewRunStateSchedule(controls map[string]*RunStateControl, schedules map[string]config.RunStateSchedule) service.Service {
+	return &RunStateSchedule{
+		controls:  controls,
+		schedules: schedules,
+		exitC:     make(chan struct{}),
+	}
+}
+
+func (s *RunStateSchedule) scheduleLoop() {
+	const (
+		checkInterval = time.Second * 15
+	)
+
+	var (
+		loopTicker = time.NewTicker(checkInterval)
+		nextRuns   = make(map[string]time.Time, len(s.schedules))
+		now        = time.Now()
+	)
+
+	defer loopTicker.Stop()
+
+	for name, schedule := range s.schedules {
+		nextRuns[name] = schedule.NextAfter(now)
+		log.Debugf("Run state schedule %s will next switch %s to %s at %s", name, schedule.Server, schedule.State, nextRuns[name])
+	}
+
+	for {
+		select {
+		case <-loopTicker.C:
+			now = time.Now()
+
+			for name, nextRun := range nextRuns {
+				if nextRun.IsZero() || now.Before(nextRun) {
+					continue
+				}
+
+				schedule := s.schedules[name]
+				if err := s.controls[schedule.Server].Change(schedule.State, fmt.Sprintf("schedule %s", name)); err != nil {
+					log.Errorf("Run state schedule %s failed to switch %s to %s: %v", name, schedule.Server, schedule.State, err)
+				}
+
+				nextRuns[name] = schedule.NextAfter(now)
+			}
+
+		case <-s.exitC:
+			return
+		}
+	}
+}
+
+func (s *RunStateSchedule) Start(supervisor service.Supervisor) {
+	supervisor.Supervise("run state schedule", s.exitC, s.scheduleLoop)
+}
+
+func (s *RunStateSchedule) Stop() {
+	close(s.exitC)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zinic/forculus/eventserver/statedb"
+	"github.com/zinic/forculus/log"
+)
+
+// SeenEvents records which Zoneminder events have already been dispatched so
+// that multiple watchers can emit new events without duplicating them
+type SeenEvents struct {
+	ttl    time.Duration
+	seen   map[string]time.Time
+	lock   *sync.Mutex
+	pruned time.Time
+
+	database   *statedb.Database
+	persistTTL time.Duration
+}
+
+func NewSeenEvents(ttl time.Duration) *SeenEvents {
+	return &SeenEvents{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+		lock: &sync.Mutex{},
+	}
+}
+
+// NewPersistentSeenEvents also records seen events in the state database so
+// that they are not dispatched again when caught up on after a restart.
+// Persisted records expire after persistTTL.
+func NewPersistentSeenEvents(ttl time.Duration, database *statedb.Database, persistTTL time.Duration) *SeenEvents {
+	seenEvents := NewSeenEvents(ttl)
+	seenEvents.database = database
+	seenEvents.persistTTL = persistTTL
+
+	return seenEvents
+}
+
+func formatSeenKey(server, eventID string) string {
+	return fmt.Sprintf("%s:%s", server, eventID)
+}
+
+// MarkSeen records the event, persisting it right away, and reports whether
+// it had not been seen before
+func (s *SeenEvents) MarkSeen(server, eventID string) bool {
+	if !s.Claim(server, eventID) {
+		return false
+	}
+
+	s.Persist(server, eventID)
+	return true
+}
+
+// Claim records the event in memory and reports whether it had not been seen
+// before. The caller persists the event with Persist once it has been
+// dispatched; an event claimed but never persisted is caught up on again
+// after a restart.
+func (s *SeenEvents) Claim(server, eventID string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	key := formatSeenKey(server, eventID)
+	if _, seen := s.seen[key]; seen {
+		return false
+	}
+
+	s.seen[key] = now
+
+	if s.database != nil {
+		if persisted, err := s.database.Seen(server, eventID); err != nil {
+			log.Errorf("Failed to read seen state of event %s on %s: %v", eventID, server, err)
+		} else if persisted {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *SeenEvents) Persist(server, eventID string) {
+	if s.database == nil {
+		return
+	}
+
+	if err := s.database.MarkSeen(server, eventID, s.persistTTL); err != nil {
+		log.Errorf("Failed to persist seen state of event %s on %s: %v", eventID, server, err)
+	}
+}
+
+func (s *SeenEvents) Seen(server, eventID string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, seen := s.seen[formatSeenKey(server, eventID)]; seen {
+		return true
+	}
+
+	if s.database != nil {
+		if persisted, err := s.database.Seen(server, eventID); err != nil {
+			log.Errorf("Failed to read seen state of event %s on %s: %v", eventID, server, err)
+		} else {
+			return persisted
+		}
+	}
+
+	return false
+}
+
+func (s *SeenEvents) prune(now time.Time) {
+	if now.Sub(s.pruned) < s.ttl/2 {
+		return
+	}
+
+	for key, seenAt := range s.seen {
+		if now.Sub(seenAt) >= s.ttl {
+			delete(s.seen, key)
+		}
+	}
+
+	s.pruned = now
+}
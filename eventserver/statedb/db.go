@@ -0,0 +1,123 @@
+package statedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/zinic/forculus/errors"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+const (
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+	checkpointKey = "checkpoints.%s"
+	seenEventKey  = "seen.%s.%s"
+)
+
+func formatCheckpointKey(server string) []byte {
+	return []byte(fmt.Sprintf(checkpointKey, server))
+}
+
+func formatSeenEventKey(server, eventID string) []byte {
+	return []byte(fmt.Sprintf(seenEventKey, server, eventID))
+}
+
+func NewDatabase(path string) (*Database, error) {
+	if bdb, err := badger.Open(badger.DefaultOptions(path)); err != nil {
+		return nil, err
+	} else {
+		return &Database{
+			db: bdb,
+		}, nil
+	}
+}
+
+// Database persists eventserver watcher state so that events created while the
+// eventserver was down can be caught up on after a restart
+type Database struct {
+	db *badger.DB
+}
+
+func (s *Database) Close() error {
+	return s.db.Close()
+}
+
+func (s *Database) Checkpoint(server string) (Checkpoint, error) {
+	var (
+		txn        = s.db.NewTransaction(false)
+		checkpoint Checkpoint
+	)
+
+	defer txn.Discard()
+
+	if item, err := txn.Get(formatCheckpointKey(server)); err != nil {
+		if err == badger.ErrKeyNotFound {
+			return checkpoint, ErrCheckpointNotFound
+		}
+
+		return checkpoint, err
+	} else if value, err := item.ValueCopy(nil); err != nil {
+		return checkpoint, err
+	} else if err := json.Unmarshal(value, &checkpoint); err != nil {
+		return checkpoint, err
+	}
+
+	return checkpoint, nil
+}
+
+// AdvanceCheckpoint stores the checkpoint for the server unless the stored one
+// is already further along
+func (s *Database) AdvanceCheckpoint(server string, checkpoint Checkpoint) error {
+	txn := s.db.NewTransaction(true)
+	defer txn.Discard()
+
+	if item, err := txn.Get(formatCheckpointKey(server)); err != nil {
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+	} else if value, err := item.ValueCopy(nil); err != nil {
+		return err
+	} else {
+		var current Checkpoint
+
+		if err := json.Unmarshal(value, &current); err != nil {
+			return err
+		} else if !checkpoint.After(current) {
+			return nil
+		}
+	}
+
+	if output, err := json.Marshal(&checkpoint); err != nil {
+		return err
+	} else if err := txn.Set(formatCheckpointKey(server), output); err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+// MarkSeen records that the event has been dispatched. The record expires
+// after the ttl.
+func (s *Database) MarkSeen(server, eventID string, ttl time.Duration) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(formatSeenEventKey(server, eventID), []byte{1}).WithTTL(ttl))
+	})
+}
+
+func (s *Database) Seen(server, eventID string) (bool, error) {
+	txn := s.db.NewTransaction(false)
+	defer txn.Discard()
+
+	if _, err := txn.Get(formatSeenEventKey(server, eventID)); err != nil {
+		if err == badger.ErrKeyNotFound {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,139 @@
+package statedb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+const (
+	journalKeyPrefix     = "journal.%s."
+	journalKey           = journalKeyPrefix + "%020d"
+	journalSequenceKey   = "journal_sequence"
+	journalSequenceLease = 1000
+)
+
+func formatJournalKey(subscription string, sequence uint64) []byte {
+	return []byte(fmt.Sprintf(journalKey, subscription, sequence))
+}
+
+// NewJournal keeps the event journal of durable subscriptions in the database.
+// Entries that are never acknowledged expire after the retention period.
+func NewJournal(db *Database, retention time.Duration) *Journal {
+	return &Journal{
+		db:           db,
+		retention:    retention,
+		sequenceLock: &sync.Mutex{},
+	}
+}
+
+type Journal struct {
+	db           *Database
+	retention    time.Duration
+	sequenceLock *sync.Mutex
+	sequence     *badger.Sequence
+}
+
+func (s *Journal) nextSequence() (uint64, error) {
+	s.sequenceLock.Lock()
+	defer s.sequenceLock.Unlock()
+
+	if s.sequence == nil {
+		if sequence, err := s.db.db.GetSequence([]byte(journalSequenceKey), journalSequenceLease); err != nil {
+			return 0, err
+		} else {
+			s.sequence = sequence
+		}
+	}
+
+	for {
+		// Zero marks an event that was never journaled
+		if next, err := s.sequence.Next(); err != nil || next > 0 {
+			return next, err
+		}
+	}
+}
+
+func (s *Journal) Append(subscription string, content []byte) (uint64, error) {
+	sequence, err := s.nextSequence()
+	if err != nil {
+		return 0, err
+	}
+
+	return sequence, s.db.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(formatJournalKey(subscription, sequence), content).WithTTL(s.retention))
+	})
+}
+
+func (s *Journal) Acknowledge(subscription string, sequence uint64) error {
+	return s.db.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(formatJournalKey(subscription, sequence))
+	})
+}
+
+type journalEntry struct {
+	sequence uint64
+	content  []byte
+}
+
+// Pending visits the unacknowledged entries of the subscription in the order
+// they were appended. Entries are read before any are visited so that the
+// visitor is free to acknowledge them.
+func (s *Journal) Pending(subscription string, visit func(sequence uint64, content []byte) error) error {
+	var (
+		entries []journalEntry
+		prefix  = []byte(fmt.Sprintf(journalKeyPrefix, subscription))
+	)
+
+	err := s.db.db.View(func(txn *badger.Txn) error {
+		iterator := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iterator.Close()
+
+		for iterator.Seek(prefix); iterator.ValidForPrefix(prefix); iterator.Next() {
+			item := iterator.Item()
+
+			// Subscriptions whose names extend this one share the prefix
+			rawSequence := strings.TrimPrefix(string(item.Key()), string(prefix))
+			if sequence, err := strconv.ParseUint(rawSequence, 10, 64); err != nil {
+				continue
+			} else if content, err := item.ValueCopy(nil); err != nil {
+				return err
+			} else {
+				entries = append(entries, journalEntry{
+					sequence: sequence,
+					content:  content,
+				})
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := visit(entry.sequence, entry.content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close returns the unused part of the leased sequence range
+func (s *Journal) Close() error {
+	s.sequenceLock.Lock()
+	defer s.sequenceLock.Unlock()
+
+	if s.sequence == nil {
+		return nil
+	}
+
+	return s.sequence.Release()
+}
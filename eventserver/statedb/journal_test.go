@@ -0,0 +1,110 @@
+package statedb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func pendingEntries(t *testing.T, journal *Journal, subscription string) []string {
+	var contents []string
+
+	err := journal.Pending(subscription, func(sequence uint64, content []byte) error {
+		contents = append(contents, string(content))
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("failed to read pending entries of %s: %v", subscription, err)
+	}
+
+	return contents
+}
+
+func expectEntries(t *testing.T, actual []string, expected ...string) {
+	if len(actual) != len(expected) {
+		t.Fatalf("expected entries %v but got %v", expected, actual)
+	}
+
+	for idx := range expected {
+		if actual[idx] != expected[idx] {
+			t.Fatalf("expected entries %v but got %v", expected, actual)
+		}
+	}
+}
+
+func TestJournalAcknowledgeAndReplay(t *testing.T) {
+	directory, err := ioutil.TempDir("", "statedb")
+	if err != nil {
+		t.Fatalf("failed to create database directory: %v", err)
+	}
+
+	defer os.RemoveAll(directory)
+
+	db, err := NewDatabase(directory)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	journal := NewJournal(db, time.Hour)
+
+	var sequences []uint64
+	for _, content := range []string{"first", "second", "third"} {
+		if sequence, err := journal.Append("uploader", []byte(content)); err != nil {
+			t.Fatalf("failed to append %s: %v", content, err)
+		} else if len(sequences) > 0 && sequence <= sequences[len(sequences)-1] {
+			t.Fatalf("expected increasing sequences but got %d after %d", sequence, sequences[len(sequences)-1])
+		} else {
+			sequences = append(sequences, sequence)
+		}
+	}
+
+	// A subscription whose name extends another shares its key prefix
+	if _, err := journal.Append("uploader.backup", []byte("other")); err != nil {
+		t.Fatalf("failed to append to the other subscription: %v", err)
+	}
+
+	if err := journal.Acknowledge("uploader", sequences[1]); err != nil {
+		t.Fatalf("failed to acknowledge: %v", err)
+	}
+
+	expectEntries(t, pendingEntries(t, journal, "uploader"), "first", "third")
+
+	// Entries may be acknowledged while they are visited
+	err = journal.Pending("uploader", func(sequence uint64, content []byte) error {
+		return journal.Acknowledge("uploader", sequence)
+	})
+
+	if err != nil {
+		t.Fatalf("failed to acknowledge while visiting: %v", err)
+	}
+
+	expectEntries(t, pendingEntries(t, journal, "uploader"))
+	expectEntries(t, pendingEntries(t, journal, "uploader.backup"), "other")
+
+	// Unacknowledged entries and the sequence survive a restart
+	if _, err := journal.Append("uploader", []byte("fourth")); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	journal.Close()
+	db.Close()
+
+	if db, err = NewDatabase(directory); err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+
+	defer db.Close()
+
+	journal = NewJournal(db, time.Hour)
+	defer journal.Close()
+
+	expectEntries(t, pendingEntries(t, journal, "uploader"), "fourth")
+
+	if sequence, err := journal.Append("uploader", []byte("fifth")); err != nil {
+		t.Fatalf("failed to append after reopening: %v", err)
+	} else if sequence <= sequences[len(sequences)-1] {
+		t.Fatalf("expected sequences to keep increasing after a restart but got %d", sequence)
+	}
+}
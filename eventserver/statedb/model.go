@@ -0,0 +1,19 @@
+package statedb
+
+import "time"
+
+// Checkpoint marks how far the events of a Zoneminder server have been
+// processed by the eventserver
+type Checkpoint struct {
+	EventID   int64     `json:"event_id"`
+	EventTime time.Time `json:"event_time"`
+}
+
+// After reports whether the checkpoint is further along than the other
+func (s Checkpoint) After(other Checkpoint) bool {
+	if s.EventID != other.EventID {
+		return s.EventID > other.EventID
+	}
+
+	return s.EventTime.After(other.EventTime)
+}
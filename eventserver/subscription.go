@@ -1,56 +1,471 @@
 package eventserver
 
 import (
+	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
 )
 
 const (
 	defaultHandlerEventBuffer = 15
 )
 
-func NewSubscription(logic EventHandlerFunc, interests ...EventType) *subscription {
+func NewSubscription(name string, logic EventHandlerFunc, interests ...EventType) *subscription {
+	newSubscription, _ := NewSubscriptionWithOptions(logic, SubscriptionOptions{Name: name}, interests...)
+	return newSubscription
+}
+
+func NewSubscriptionWithOptions(logic EventHandlerFunc, options SubscriptionOptions, interests ...EventType) (*subscription, error) {
+	options = options.withDefaults()
+
+	if options.Journal != nil && len(options.Name) == 0 {
+		return nil, fmt.Errorf("durable subscriptions must be named")
+	}
+
 	interestsMap := make(map[EventType]struct{}, len(interests))
 	for _, eventInterest := range interests {
 		interestsMap[eventInterest] = struct{}{}
 	}
 
-	return &subscription{
-		eventC:    make(chan Event, defaultHandlerEventBuffer),
-		exitC:     make(chan struct{}),
-		logic:     logic,
-		interests: interestsMap,
+	newSubscription := &subscription{
+		name:       options.Name,
+		options:    options,
+		eventC:     make(chan Event, options.BufferSize),
+		exitC:      make(chan struct{}),
+		stopOnce:   &sync.Once{},
+		logic:      logic,
+		interests:  interestsMap,
+		turnLock:   &sync.Mutex{},
+		replayOnce: &sync.Once{},
+		backlogC:   make(chan []Event, 1),
+	}
+
+	newSubscription.turnCond = sync.NewCond(newSubscription.turnLock)
+
+	if options.Policy == Spill {
+		if overflow, err := newSpillQueue(options.SpillPath, options.Name, options.Journal != nil); err != nil {
+			return nil, err
+		} else {
+			newSubscription.overflow = overflow
+			newSubscription.overflowC = make(chan struct{}, 1)
+		}
 	}
+
+	return newSubscription, nil
+}
+
+type SubscriptionID uint64
+
+// SubscriptionInfo describes a registered subscription along with what
+// happened to the events sent to it
+type SubscriptionInfo struct {
+	ID           SubscriptionID     `json:"id"`
+	Name         string             `json:"name"`
+	Interests    []EventType        `json:"interests"`
+	Paused       bool               `json:"paused"`
+	Durable      bool               `json:"durable"`
+	Policy       BackpressurePolicy `json:"policy"`
+	BufferSize   int                `json:"buffer_size"`
+	Buffered     int                `json:"buffered"`
+	Pending      int                `json:"spill_pending"`
+	Received     uint64             `json:"received"`
+	Dropped      uint64             `json:"dropped"`
+	Spilled      uint64             `json:"spilled"`
+	Skipped      uint64             `json:"skipped"`
+	LastActivity *time.Time         `json:"last_activity,omitempty"`
 }
 
 type subscription struct {
+	// Accessed atomically
+	received     uint64
+	dropped      uint64
+	spilled      uint64
+	skipped      uint64
+	lastActivity int64
+	paused       int32
+
+	id        SubscriptionID
 	name      string
+	options   SubscriptionOptions
 	eventC    chan Event
 	exitC     chan struct{}
+	stopOnce  *sync.Once
 	logic     EventHandlerFunc
 	interests map[EventType]struct{}
+	overflow  *spillQueue
+	overflowC chan struct{}
+
+	// Blocked sends wait for their turn so that they reach the handler in the
+	// order they were dispatched in
+	turnLock   *sync.Mutex
+	turnCond   *sync.Cond
+	nextTicket uint64
+	turn       uint64
+
+	replayOnce *sync.Once
+	backlogC   chan []Event
 }
 
-func (s *subscription) Start(waitGroup *sync.WaitGroup) {
-	waitGroup.Add(1)
+// supervisedName identifies the handler of the subscription to the supervisor.
+// It is unique since crash reports are matched back to subscriptions by name.
+func (s *subscription) supervisedName() string {
+	if len(s.name) > 0 {
+		return fmt.Sprintf("%s (subscription %d)", s.name, s.id)
+	}
 
-	go func() {
-		s.logic(s.eventC, s.exitC)
-		waitGroup.Done()
-	}()
+	return fmt.Sprintf("subscription %d", s.id)
+}
+
+// run is the handler loop of the subscription. The reactor hands it to the
+// supervisor so that a handler that crashes is restarted with the same buffer.
+func (s *subscription) run() {
+	s.logic(s.eventC, s.exitC)
+}
+
+// Start only starts the overflow drain and journal replay of the subscription
+// since the reactor supervises its handler itself
+func (s *subscription) Start(supervisor service.Supervisor) {
+	if s.overflow != nil {
+		supervisor.Supervise(s.supervisedName()+" overflow", s.exitC, s.drainOverflow)
+	} else if s.options.Journal != nil {
+		supervisor.Supervise(s.supervisedName()+" replay", s.exitC, s.feedBacklog)
+	}
 }
 
+// Stop may be called more than once since an unregistered subscription is
+// stopped again when the reactor shuts down
 func (s *subscription) Stop() {
-	close(s.exitC)
+	s.stopOnce.Do(func() {
+		close(s.exitC)
+	})
+}
+
+func (s *subscription) setPaused(paused bool) {
+	if paused {
+		atomic.StoreInt32(&s.paused, 1)
+	} else {
+		atomic.StoreInt32(&s.paused, 0)
+	}
+}
+
+func (s *subscription) Paused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
+
+// skip accounts for an event sent while the subscription was paused
+func (s *subscription) skip() {
+	atomic.AddUint64(&s.skipped, 1)
 }
 
-func (s *subscription) Send(event Event) {
+func (s *subscription) touch() {
+	atomic.AddUint64(&s.received, 1)
+	atomic.StoreInt64(&s.lastActivity, time.Now().UnixNano())
+}
+
+// drop discards the event. Journaled events are acknowledged so that a
+// durable subscription does not replay what it dropped after a restart.
+func (s *subscription) drop(event Event, reason string) {
+	event.Ack()
+
+	dropped := atomic.AddUint64(&s.dropped, 1)
+	log.Errorf("Dropped event %s for handler %s: %s. %d events have been dropped for this handler.", event.Type, s.name, reason, dropped)
+}
+
+// drainOverflow feeds spilled events back to the handler in order as room
+// becomes available in the buffer
+func (s *subscription) drainOverflow() {
+	// The drain is restarted after crashes so the queue is only closed once
+	// the subscription has been stopped
+	defer func() {
+		select {
+		case <-s.exitC:
+			s.overflow.Close()
+		default:
+		}
+	}()
+
+	for {
+		if s.overflow.Pending() == 0 {
+			select {
+			case <-s.overflowC:
+				continue
+			case <-s.exitC:
+				return
+			}
+		}
+
+		if event, sequence, err := s.overflow.Peek(); err != nil {
+			log.Errorf("Discarding unreadable spilled event for handler %s: %v", s.name, err)
+			atomic.AddUint64(&s.dropped, 1)
+		} else {
+			event = s.withReceipt(event, sequence)
+
+			select {
+			case s.eventC <- event:
+			case <-s.exitC:
+				return
+			}
+		}
+
+		if err := s.overflow.Commit(); err != nil {
+			log.Errorf("Failed to advance spill queue for handler %s: %v", s.name, err)
+		}
+	}
+}
+
+func (s *subscription) sendOrSpill(event Event) {
+	// Once events are spilled every following event is spilled as well so
+	// that the handler still sees them in order
+	if s.overflow.Pending() == 0 {
+		select {
+		case s.eventC <- event:
+			return
+		default:
+		}
+	}
+
+	if err := s.overflow.Push(event); err != nil {
+		s.drop(event, "spilling to disk failed: "+err.Error())
+		return
+	}
+
+	atomic.AddUint64(&s.spilled, 1)
+
+	select {
+	case s.overflowC <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) withReceipt(event Event, sequence uint64) Event {
+	if s.options.Journal != nil && sequence > 0 {
+		event.receipt = &receipt{
+			journal:      s.options.Journal,
+			subscription: s.name,
+			sequence:     sequence,
+		}
+	}
+
+	return event
+}
+
+// journal persists the event for a durable subscription. Events that can not
+// be journaled are still delivered, they just will not survive a restart.
+func (s *subscription) journal(event Event) Event {
+	if encoded, err := encodeEvent(event); err != nil {
+		log.Errorf("Failed to journal event %s for handler %s: %v", event.Type, s.name, err)
+	} else if sequence, err := s.options.Journal.Append(s.name, encoded); err != nil {
+		log.Errorf("Failed to journal event %s for handler %s: %v", event.Type, s.name, err)
+	} else {
+		event = s.withReceipt(event, sequence)
+	}
+
+	return event
+}
+
+// replay delivers the journaled events a durable subscription had not
+// acknowledged before the last shutdown. The backlog is read right away so
+// that events journaled from then on are not delivered twice. Spill
+// subscriptions queue it on disk, all others are fed it in the background
+// until it has been delivered or the subscription stops. Only the first call
+// replays.
+func (s *subscription) replay() {
+	if s.options.Journal == nil {
+		return
+	}
+
+	s.replayOnce.Do(func() {
+		backlog := s.readBacklog()
+		if len(backlog) == 0 {
+			return
+		}
+
+		if s.overflow != nil {
+			for _, event := range backlog {
+				s.sendOrSpill(event)
+			}
+
+			log.Infof("Replayed %d journaled events to handler %s", len(backlog), s.name)
+		} else {
+			s.backlogC <- backlog
+		}
+	})
+}
+
+func (s *subscription) readBacklog() []Event {
+	var backlog []Event
+
+	err := s.options.Journal.Pending(s.name, func(sequence uint64, content []byte) error {
+		if event, _, err := decodeEvent(content); err != nil {
+			log.Errorf("Discarding unreadable journaled event %d for handler %s: %v", sequence, s.name, err)
+			return s.options.Journal.Acknowledge(s.name, sequence)
+		} else {
+			backlog = append(backlog, s.withReceipt(event, sequence))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.Errorf("Failed to read journaled events for handler %s, %d will be replayed: %v", s.name, len(backlog), err)
+	}
+
+	return backlog
+}
+
+// feedBacklog waits for replay and hands the backlog to the handler as it
+// makes room for it. Events not delivered before the subscription stops stay
+// journaled for the next start.
+func (s *subscription) feedBacklog() {
+	var backlog []Event
+
+	select {
+	case backlog = <-s.backlogC:
+	case <-s.exitC:
+		return
+	}
+
+	for replayed, event := range backlog {
+		select {
+		case s.eventC <- event:
+		case <-s.exitC:
+			log.Infof("Replayed %d of %d journaled events to handler %s before it stopped", replayed, len(backlog), s.name)
+			return
+		}
+	}
+
+	log.Infof("Replayed %d journaled events to handler %s", len(backlog), s.name)
+}
+
+// sendOrWait buffers the event right away when there is room and no earlier
+// event is waiting. Otherwise it returns a wait that blocks until the event
+// has been buffered or timed out.
+func (s *subscription) sendOrWait(event Event) func() {
+	s.turnLock.Lock()
+	defer s.turnLock.Unlock()
+
+	if s.nextTicket == s.turn {
+		select {
+		case s.eventC <- event:
+			return nil
+		default:
+		}
+	}
+
+	ticket := s.nextTicket
+	s.nextTicket++
+
+	return func() {
+		s.waitTurn(ticket, event)
+	}
+}
+
+func (s *subscription) waitTurn(ticket uint64, event Event) {
+	s.turnLock.Lock()
+	for s.turn != ticket {
+		s.turnCond.Wait()
+	}
+	s.turnLock.Unlock()
+
+	blockTimer := time.NewTimer(s.options.BlockTimeout)
+
 	select {
 	case s.eventC <- event:
+	case <-blockTimer.C:
+		s.drop(event, "timed out waiting for the handler")
+	case <-s.exitC:
+	}
+
+	blockTimer.Stop()
+
+	s.turnLock.Lock()
+	s.turn++
+	s.turnCond.Broadcast()
+	s.turnLock.Unlock()
+}
+
+// Send delivers the event according to the backpressure policy. Block
+// subscriptions may return a wait which the caller must run once it no longer
+// holds up dispatch.
+func (s *subscription) Send(event Event) (wait func()) {
+	s.touch()
+
+	if s.options.Journal != nil {
+		event = s.journal(event)
+	}
+
+	switch s.options.Policy {
+	case Spill:
+		s.sendOrSpill(event)
+
+	case Block:
+		return s.sendOrWait(event)
+
+	case DropOldest:
+		for {
+			select {
+			case s.eventC <- event:
+				return
+			default:
+			}
+
+			select {
+			case oldest := <-s.eventC:
+				s.drop(oldest, "handler is processing events too slowly")
+			default:
+			}
+		}
+
 	default:
-		log.Errorf("Failed to publish event %s to handler %s. Handler is processing events too slowly.", event.Type, s.name)
+		select {
+		case s.eventC <- event:
+		default:
+			s.drop(event, "handler is processing events too slowly")
+		}
+	}
+
+	return nil
+}
+
+func (s *subscription) Info() SubscriptionInfo {
+	info := SubscriptionInfo{
+		ID:         s.id,
+		Name:       s.name,
+		Interests:  make([]EventType, 0, len(s.interests)),
+		Paused:     s.Paused(),
+		Durable:    s.options.Journal != nil,
+		Policy:     s.options.Policy,
+		BufferSize: s.options.BufferSize,
+		Buffered:   len(s.eventC),
+		Received:   atomic.LoadUint64(&s.received),
+		Dropped:    atomic.LoadUint64(&s.dropped),
+		Spilled:    atomic.LoadUint64(&s.spilled),
+		Skipped:    atomic.LoadUint64(&s.skipped),
+	}
+
+	for interest := range s.interests {
+		info.Interests = append(info.Interests, interest)
+	}
+
+	sort.Slice(info.Interests, func(i, j int) bool {
+		return info.Interests[i] < info.Interests[j]
+	})
+
+	if s.overflow != nil {
+		info.Pending = s.overflow.Pending()
 	}
+
+	if lastActivity := atomic.LoadInt64(&s.lastActivity); lastActivity > 0 {
+		lastActivityTime := time.Unix(0, lastActivity)
+		info.LastActivity = &lastActivityTime
+	}
+
+	return info
 }
 
 func (s *subscription) Accepts(eventType EventType) bool {
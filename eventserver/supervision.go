@@ -0,0 +1,41 @@
+package eventserver
+
+import (
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/service"
+)
+
+func init() {
+	RegisterPayload(service.CrashReport{}, ActorCrashed)
+	RegisterPayload(service.RestartReport{}, ActorRestarted)
+}
+
+// Crashed dispatches an ActorCrashed event for every handler or service the
+// manager recovered. The stack trace has already been logged by then. A
+// subscription whose handler is given up on is unregistered first so that
+// events stop piling up in its buffer.
+func (s *reactor) Crashed(report service.CrashReport) {
+	if report.GaveUp {
+		for _, sub := range s.currentSubscriptions() {
+			if sub.supervisedName() != report.Name {
+				continue
+			}
+
+			if err := s.Unregister(sub.id); err != nil {
+				log.Errorf("Failed to unregister subscription %d (%s) after its handler was given up on: %v", sub.id, sub.name, err)
+			}
+		}
+	}
+
+	s.Send(Event{
+		Type:    ActorCrashed,
+		Payload: report,
+	})
+}
+
+func (s *reactor) Restarted(report service.RestartReport) {
+	s.Send(Event{
+		Type:    ActorRestarted,
+		Payload: report,
+	})
+}
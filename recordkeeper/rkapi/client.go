@@ -20,15 +20,16 @@ type Credentials struct {
 	Password string
 }
 
-func NewClient(credentials Credentials, endpoint apitools.Endpoint) Client {
+func NewClient(credentials Credentials, endpoint apitools.Endpoint, httpClient *http.Client) Client {
 	return &recordKeeperClient{
 		credentials: credentials,
-		httpClient:  apitools.NewHTTPClientWrapper(endpoint),
+		httpClient:  apitools.NewHTTPClientWrapper(endpoint, httpClient),
 	}
 }
 
 type Client interface {
 	CreateEventRecord(req rkdb.CreateEventRecord) (int64, error)
+	FindEventRecord(source rkdb.EventSource) (rkdb.EventRecord, error)
 	FormatEventURL(id int64, accessToken string) string
 }
 
@@ -80,3 +81,35 @@ func (s *recordKeeperClient) CreateEventRecord(req rkdb.CreateEventRecord) (int6
 		}
 	}
 }
+
+func (s *recordKeeperClient) FindEventRecord(source rkdb.EventSource) (rkdb.EventRecord, error) {
+	var (
+		record  rkdb.EventRecord
+		headers = http.Header{
+			server.AuthorizationHeaderKey: []string{s.authHeaderValue()},
+		}
+		query = url.Values{
+			server.SourceStorageTargetKey: []string{source.StorageTarget},
+			server.SourceServerKey:        []string{source.Server},
+			server.SourceEventIDKey:       []string{source.EventID},
+		}
+	)
+
+	if resp, err := s.httpClient.GET(nil, query, headers, "events"); err != nil {
+		return record, err
+	} else {
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return record, rkdb.ErrEventNotFound
+		} else if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return record, fmt.Errorf("response error %d", resp.StatusCode)
+		} else if input, err := ioutil.ReadAll(resp.Body); err != nil {
+			return record, fmt.Errorf("failed to read response body %v", err)
+		} else if err := json.Unmarshal(input, &record); err != nil {
+			return record, fmt.Errorf("failed to unmarshal response body %v", err)
+		}
+
+		return record, nil
+	}
+}
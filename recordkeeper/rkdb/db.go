@@ -14,14 +14,19 @@ import (
 const (
 	ErrEventNotFound = errors.New("event not found")
 
-	eventRecordIDKey = "events.next_id"
-	eventRecordKey   = "events.id_%d"
+	eventRecordIDKey     = "events.next_id"
+	eventRecordKey       = "events.id_%d"
+	eventRecordSourceKey = "events.source_%s.%s.%s"
 )
 
 func formatRecordKey(id int64) []byte {
 	return []byte(fmt.Sprintf(eventRecordKey, id))
 }
 
+func formatSourceKey(source EventSource) []byte {
+	return []byte(fmt.Sprintf(eventRecordSourceKey, source.StorageTarget, source.Server, source.EventID))
+}
+
 func nextEventID(txn *badger.Txn) (int64, error) {
 	var (
 		currentID int64 = 0
@@ -80,6 +85,15 @@ func (s *Database) WriteEventRecord(record EventRecord) (int64, error) {
 			return 0, err
 		}
 
+		if source, hasSource := record.Source(); hasSource {
+			value := make([]byte, binary.MaxVarintLen64)
+			binary.PutVarint(value, record.ID)
+
+			if err := txn.Set(formatSourceKey(source), value); err != nil {
+				return 0, err
+			}
+		}
+
 		return eventID, txn.Commit()
 	}
 }
@@ -106,3 +120,24 @@ func (s *Database) GetEventRecord(id int64) (EventRecord, error) {
 
 	return record, nil
 }
+
+// FindEventRecord looks up the record created for a Zoneminder event in the
+// given storage target
+func (s *Database) FindEventRecord(source EventSource) (EventRecord, error) {
+	txn := s.db.NewTransaction(false)
+	defer txn.Discard()
+
+	if item, err := txn.Get(formatSourceKey(source)); err != nil {
+		if err == badger.ErrKeyNotFound {
+			return EventRecord{}, ErrEventNotFound
+		}
+
+		return EventRecord{}, err
+	} else if value, err := item.ValueCopy(nil); err != nil {
+		return EventRecord{}, err
+	} else if recordID, err := binary.ReadVarint(bytes.NewBuffer(value)); err != nil {
+		return EventRecord{}, err
+	} else {
+		return s.GetEventRecord(recordID)
+	}
+}
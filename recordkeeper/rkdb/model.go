@@ -1,5 +1,10 @@
 package rkdb
 
+const (
+	ServerTag  = "server"
+	EventIDTag = "event_id"
+)
+
 type CreateEventRecord struct {
 	StorageTarget string            `json:"storage_target"`
 	StorageKey    string            `json:"storage_key"`
@@ -14,3 +19,20 @@ type EventRecord struct {
 	AccessToken   string            `json:"access_token"`
 	Tags          map[string]string `json:"tags"`
 }
+
+// EventSource identifies the Zoneminder event a record was created for
+type EventSource struct {
+	StorageTarget string `json:"storage_target"`
+	Server        string `json:"server"`
+	EventID       string `json:"event_id"`
+}
+
+func (s EventRecord) Source() (EventSource, bool) {
+	source := EventSource{
+		StorageTarget: s.StorageTarget,
+		Server:        s.Tags[ServerTag],
+		EventID:       s.Tags[EventIDTag],
+	}
+
+	return source, len(source.Server) > 0 && len(source.EventID) > 0
+}
@@ -45,6 +45,10 @@ func (s *Handler) Close() error {
 const (
 	eventIDVarKey       = "event_id"
 	EventAccessTokenKey = "access_token"
+
+	SourceStorageTargetKey = "storage_target"
+	SourceServerKey        = "server"
+	SourceEventIDKey       = "event_id"
 )
 
 func (s *Handler) GetEvent(resp ResponseWrapper, req *http.Request) {
@@ -107,3 +111,29 @@ func (s *Handler) PostEvent(resp ResponseWrapper, req *http.Request) {
 		}
 	}
 }
+
+func (s *Handler) FindEvent(resp ResponseWrapper, req *http.Request) {
+	var (
+		query  = req.URL.Query()
+		source = rkdb.EventSource{
+			StorageTarget: query.Get(SourceStorageTargetKey),
+			Server:        query.Get(SourceServerKey),
+			EventID:       query.Get(SourceEventIDKey),
+		}
+	)
+
+	if len(source.StorageTarget) == 0 || len(source.Server) == 0 || len(source.EventID) == 0 {
+		resp.Errorf(http.StatusBadRequest, "%s, %s and %s must all be specified", SourceStorageTargetKey, SourceServerKey, SourceEventIDKey)
+	} else if eventRecord, err := s.database.FindEventRecord(source); err != nil {
+		if err == rkdb.ErrEventNotFound {
+			resp.Errorf(http.StatusNotFound, "no record for event %s on %s", source.EventID, source.Server)
+		} else {
+			resp.Error(http.StatusInternalServerError, "database error")
+		}
+	} else if output, err := json.Marshal(&eventRecord); err != nil {
+		resp.Errorf(http.StatusInternalServerError, "response marshaling error: %v", err)
+	} else {
+		resp.WriteHeader(http.StatusOK)
+		resp.Write(output)
+	}
+}
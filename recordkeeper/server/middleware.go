@@ -14,7 +14,7 @@ const (
 	AuthorizationHeaderKey    = "Authorization"
 )
 
-func methodFilter(handler HandlerFunc, accepts ...string) http.HandlerFunc {
+func MethodFilter(handler HandlerFunc, accepts ...string) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
 		handlesMethod := false
 		for _, acceptedMethod := range accepts {
@@ -36,7 +36,7 @@ func methodFilter(handler HandlerFunc, accepts ...string) http.HandlerFunc {
 	}
 }
 
-func authFilter(users map[string]config.AuthorizationConfig, handler http.HandlerFunc) http.HandlerFunc {
+func AuthFilter(users map[string]config.AuthorizationConfig, handler http.HandlerFunc) http.HandlerFunc {
 	var (
 		userHashes = make(map[string]string)
 		hasher     = sha256.New()
@@ -58,7 +58,7 @@ func authFilter(users map[string]config.AuthorizationConfig, handler http.Handle
 		} else if hashMethod := authHeaderParts[0]; hashMethod != SHA256AuthorizationMethod {
 			writer.WriteHeader(http.StatusBadRequest)
 		} else if _, authValid := userHashes[authHeaderParts[1]]; !authValid {
-			writer.WriteHeader(http.StatusBadRequest)
+			writer.WriteHeader(http.StatusUnauthorized)
 		} else {
 			handler(writer, request)
 		}
@@ -10,8 +10,9 @@ import (
 
 func newMux(handler Handler, users map[string]config.AuthorizationConfig) http.Handler {
 	router := mux.NewRouter()
-	router.HandleFunc("/event", authFilter(users, methodFilter(handler.PostEvent, http.MethodPost)))
-	router.HandleFunc("/event/{event_id}", methodFilter(handler.GetEvent, http.MethodGet))
+	router.HandleFunc("/event", AuthFilter(users, MethodFilter(handler.PostEvent, http.MethodPost)))
+	router.HandleFunc("/event/{event_id}", MethodFilter(handler.GetEvent, http.MethodGet))
+	router.HandleFunc("/events", AuthFilter(users, MethodFilter(handler.FindEvent, http.MethodGet)))
 
 	return router
 }
@@ -2,25 +2,46 @@ package service
 
 import "sync"
 
+// Service runs its loops under the supervisor it is started with, which
+// restarts loops that crash until the service is stopped
 type Service interface {
-	Start(waitGroup *sync.WaitGroup)
+	Start(supervisor Supervisor)
 	Stop()
 }
 
+// Supervisor runs work until exitC is closed, restarting it after crashes
+type Supervisor interface {
+	Supervise(name string, exitC <-chan struct{}, work func())
+}
+
 func NewManager() *Manager {
+	return NewManagerWithPolicy(RestartPolicy{})
+}
+
+func NewManagerWithPolicy(policy RestartPolicy) *Manager {
 	return &Manager{
 		waitGroup: &sync.WaitGroup{},
+		policy:    policy.withDefaults(),
 	}
 }
 
 type Manager struct {
 	services  []Service
 	waitGroup *sync.WaitGroup
+	policy    RestartPolicy
+	listener  SupervisionListener
+}
+
+// Notify sets the listener told about crashes and restarts of supervised work.
+// It must be set before any work is supervised.
+func (s *Manager) Notify(listener SupervisionListener) {
+	s.listener = listener
 }
 
+// Start starts the service with the manager as its supervisor
 func (s *Manager) Start(service Service) {
 	s.services = append(s.services, service)
-	service.Start(s.waitGroup)
+	service.Start(s)
 }
 
 func (s *Manager) Stop() {
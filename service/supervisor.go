@@ -0,0 +1,242 @@
+package service
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/zinic/forculus/log"
+)
+
+// RestartStrategy decides what the manager does with supervised work that
+// panics or returns before it has been stopped
+type RestartStrategy string
+
+const (
+	// OneForOne restarts only the work that crashed
+	OneForOne RestartStrategy = "one_for_one"
+
+	// Temporary never restarts crashed work
+	Temporary RestartStrategy = "temporary"
+)
+
+const (
+	defaultMaxRestarts   = 5
+	defaultRestartWindow = time.Minute
+	defaultMinBackoff    = time.Second
+	defaultMaxBackoff    = time.Second * 30
+)
+
+func ParseRestartStrategy(raw string) (RestartStrategy, error) {
+	switch strategy := RestartStrategy(raw); strategy {
+	case "":
+		return OneForOne, nil
+
+	case OneForOne, Temporary:
+		return strategy, nil
+
+	default:
+		return "", fmt.Errorf("unknown restart strategy %s", raw)
+	}
+}
+
+// RestartPolicy limits how often crashed work is restarted. Work that crashes
+// more than MaxRestarts times within Window is given up on. The delay before
+// each restart doubles from MinBackoff with every recent restart, up to
+// MaxBackoff.
+type RestartPolicy struct {
+	Strategy    RestartStrategy
+	MaxRestarts int
+	Window      time.Duration
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+func (s RestartPolicy) withDefaults() RestartPolicy {
+	if len(s.Strategy) == 0 {
+		s.Strategy = OneForOne
+	}
+
+	if s.MaxRestarts <= 0 {
+		s.MaxRestarts = defaultMaxRestarts
+	}
+
+	if s.Window <= 0 {
+		s.Window = defaultRestartWindow
+	}
+
+	if s.MinBackoff <= 0 {
+		s.MinBackoff = defaultMinBackoff
+	}
+
+	if s.MaxBackoff <= 0 {
+		s.MaxBackoff = defaultMaxBackoff
+	}
+
+	if s.MaxBackoff < s.MinBackoff {
+		s.MaxBackoff = s.MinBackoff
+	}
+
+	return s
+}
+
+func (s RestartPolicy) backoff(recentRestarts int) time.Duration {
+	backoff := s.MinBackoff
+	for idx := 0; idx < recentRestarts && backoff < s.MaxBackoff; idx++ {
+		backoff *= 2
+	}
+
+	if backoff > s.MaxBackoff {
+		return s.MaxBackoff
+	}
+
+	return backoff
+}
+
+// CrashReport describes supervised work that panicked or returned before it
+// was stopped
+type CrashReport struct {
+	Name   string
+	Reason string
+	Stack  string
+	Time   time.Time
+
+	// Restarts is the number of times the work was restarted within the
+	// restart window before this crash
+	Restarts int
+
+	// GaveUp is set when the work will not be restarted again
+	GaveUp bool
+}
+
+type RestartReport struct {
+	Name    string
+	Attempt int
+	Backoff time.Duration
+	Time    time.Time
+}
+
+// SupervisionListener is told about every crash and restart of supervised work
+type SupervisionListener interface {
+	Crashed(report CrashReport)
+	Restarted(report RestartReport)
+}
+
+// Supervise runs work in its own goroutine until exitC is closed. Panics are
+// recovered and work that crashes or returns early is restarted according to
+// the restart policy of the manager.
+func (s *Manager) Supervise(name string, exitC <-chan struct{}, work func()) {
+	s.waitGroup.Add(1)
+
+	go func() {
+		s.supervise(name, exitC, work)
+		s.waitGroup.Done()
+	}()
+}
+
+func stopped(exitC <-chan struct{}) bool {
+	select {
+	case <-exitC:
+		return true
+	default:
+		return false
+	}
+}
+
+// runRecovered calls work and turns a panic into a crash report
+func runRecovered(name string, work func()) (report *CrashReport) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			report = &CrashReport{
+				Name:   name,
+				Reason: fmt.Sprintf("panic: %v", recovered),
+				Stack:  string(debug.Stack()),
+				Time:   time.Now(),
+			}
+		}
+	}()
+
+	work()
+	return nil
+}
+
+func (s *Manager) supervise(name string, exitC <-chan struct{}, work func()) {
+	var restarts []time.Time
+
+	for {
+		report := runRecovered(name, work)
+
+		if stopped(exitC) {
+			if report != nil {
+				log.Errorf("%s crashed while stopping: %s\n%s", name, report.Reason, report.Stack)
+			}
+
+			return
+		}
+
+		if report == nil {
+			report = &CrashReport{
+				Name:   name,
+				Reason: "returned before it was stopped",
+				Time:   time.Now(),
+			}
+		}
+
+		// Only restarts within the window count towards the limit
+		recentRestarts := restarts[:0]
+		for _, restart := range restarts {
+			if report.Time.Sub(restart) < s.policy.Window {
+				recentRestarts = append(recentRestarts, restart)
+			}
+		}
+
+		restarts = recentRestarts
+		report.Restarts = len(restarts)
+		report.GaveUp = s.policy.Strategy == Temporary || len(restarts) >= s.policy.MaxRestarts
+
+		if len(report.Stack) > 0 {
+			log.Errorf("%s crashed: %s\n%s", name, report.Reason, report.Stack)
+		} else {
+			log.Errorf("%s crashed: %s", name, report.Reason)
+		}
+
+		s.notifyCrashed(*report)
+
+		if report.GaveUp {
+			log.Errorf("%s will not be restarted after %d restarts within %s", name, len(restarts), s.policy.Window)
+			return
+		}
+
+		backoff := s.policy.backoff(len(restarts))
+		backoffTimer := time.NewTimer(backoff)
+
+		select {
+		case <-backoffTimer.C:
+		case <-exitC:
+			backoffTimer.Stop()
+			return
+		}
+
+		restarts = append(restarts, time.Now())
+		log.Infof("Restarting %s after %s (restart %d within %s)", name, backoff, len(restarts), s.policy.Window)
+
+		s.notifyRestarted(RestartReport{
+			Name:    name,
+			Attempt: len(restarts),
+			Backoff: backoff,
+			Time:    time.Now(),
+		})
+	}
+}
+
+func (s *Manager) notifyCrashed(report CrashReport) {
+	if s.listener != nil {
+		s.listener.Crashed(report)
+	}
+}
+
+func (s *Manager) notifyRestarted(report RestartReport) {
+	if s.listener != nil {
+		s.listener.Restarted(report)
+	}
+}
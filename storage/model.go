@@ -4,6 +4,11 @@ import (
 	"io"
 
 	"github.com/zinic/forculus/config"
+	"github.com/zinic/forculus/errors"
+)
+
+const (
+	ErrNotFound = errors.New("object not found")
 )
 
 type Provider interface {
@@ -11,6 +16,8 @@ type Provider interface {
 	Validate(cfg config.StorageProvider) error
 	Write(key string, reader io.Reader) error
 	Read(key string) (io.ReadCloser, error)
+
+	// Stat returns ErrNotFound when nothing is stored under the key
 	Stat(key string) (Details, error)
 }
 
@@ -9,6 +9,7 @@ import (
 	"github.com/zinic/forculus/storage"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
 	"github.com/aws/aws-sdk-go-v2/aws/defaults"
 	"github.com/aws/aws-sdk-go-v2/service/s3/s3manager"
 	"github.com/zinic/forculus/config"
@@ -28,8 +29,15 @@ func listRequiredKeys() []string {
 	return []string{regionProperty, bucketProperty, accessKeyIDProperty, secretAccessKeyProperty}
 }
 
-func newAWSConfig(cfg config.StorageProvider) aws.Config {
+func newAWSConfig(cfg config.StorageProvider) (aws.Config, error) {
 	awsCfg := defaults.Config()
+
+	if httpClient, err := cfg.Transport.NewHTTPClient(); err != nil {
+		return awsCfg, err
+	} else {
+		awsCfg.HTTPClient = httpClient
+	}
+
 	awsCfg.Region = cfg.Properties[regionProperty]
 	awsCfg.Credentials = &aws.StaticCredentialsProvider{
 		Value: aws.Credentials{
@@ -38,7 +46,7 @@ func newAWSConfig(cfg config.StorageProvider) aws.Config {
 		},
 	}
 
-	return awsCfg
+	return awsCfg, nil
 }
 
 type S3Provider struct {
@@ -52,7 +60,11 @@ func (s *S3Provider) Configure(cfg config.StorageProvider) error {
 		return err
 	}
 
-	awsCfg := newAWSConfig(cfg)
+	awsCfg, err := newAWSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
 	s.s3Uploader = s3manager.NewUploader(awsCfg)
 	s.s3Client = s3.New(awsCfg)
 	s.cfg = cfg
@@ -78,6 +90,10 @@ func (s *S3Provider) Validate(cfg config.StorageProvider) error {
 		}
 	}
 
+	if _, err := cfg.Transport.Options(); err != nil {
+		return fmt.Errorf("S3 transport configuration is malformed: %w", err)
+	}
+
 	return nil
 }
 
@@ -126,6 +142,10 @@ func (s *S3Provider) Stat(key string) (storage.Details, error) {
 	})
 
 	if resp, err := req.Send(context.Background()); err != nil {
+		if awsErr, isAWSErr := err.(awserr.Error); isAWSErr && awsErr.Code() == "NotFound" {
+			return details, storage.ErrNotFound
+		}
+
 		return details, err
 	} else {
 		details.Size = *resp.ContentLength
@@ -0,0 +1,380 @@
+package zmapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zinic/forculus/apitools"
+	"github.com/zinic/forculus/log"
+)
+
+type AuthMode string
+
+const (
+	AuthModeAuto     AuthMode = "auto"
+	AuthModeNone     AuthMode = "none"
+	AuthModeToken    AuthMode = "token"
+	AuthModeAuthHash AuthMode = "auth_hash"
+	AuthModeAPIKey   AuthMode = "api_key"
+
+	// Legacy auth hashes are only valid for AUTH_HASH_TTL on the Zoneminder
+	// server, which defaults to two hours
+	authHashRefreshInterval = time.Hour
+)
+
+func ParseAuthMode(raw string) (AuthMode, error) {
+	switch AuthMode(strings.ToLower(raw)) {
+	case "", AuthModeAuto:
+		return AuthModeAuto, nil
+
+	case AuthModeNone:
+		return AuthModeNone, nil
+
+	case AuthModeToken:
+		return AuthModeToken, nil
+
+	case AuthModeAuthHash:
+		return AuthModeAuthHash, nil
+
+	case AuthModeAPIKey:
+		return AuthModeAPIKey, nil
+
+	default:
+		return "", fmt.Errorf("unknown zoneminder auth mode %s", raw)
+	}
+}
+
+type authStrategy interface {
+	Mode() AuthMode
+	Login() error
+	RefreshLogin() error
+	CheckLogin() error
+	Session() LoginSession
+	Apply(query url.Values)
+}
+
+// loginAdapter returns the version adapter that handles login requests
+type loginAdapter func() versionAdapter
+
+func newAuthStrategy(httpClient *apitools.HTTPClientWrapper, credentials LoginCredentials, adapter loginAdapter) (authStrategy, error) {
+	switch credentials.Mode {
+	case AuthModeNone:
+		return &noAuth{}, nil
+
+	case AuthModeAPIKey:
+		if len(credentials.APIKey) == 0 {
+			return nil, fmt.Errorf("auth mode %s requires an API key", AuthModeAPIKey)
+		}
+
+		return &apiKeyAuth{
+			apiKey: credentials.APIKey,
+		}, nil
+
+	case AuthModeToken:
+		return &tokenAuth{
+			httpClient:  httpClient,
+			credentials: credentials,
+			adapter:     adapter,
+		}, nil
+
+	case AuthModeAuthHash:
+		return &authHashAuth{
+			httpClient:  httpClient,
+			credentials: credentials,
+			adapter:     adapter,
+		}, nil
+
+	default:
+		return detectAuthStrategy(httpClient, credentials, adapter)
+	}
+}
+
+// detectAuthStrategy probes the Zoneminder version endpoint without credentials
+// to find out whether OPT_USE_AUTH is enabled and, if it is, inspects the login
+// response to pick between token and legacy auth hash authentication.
+func detectAuthStrategy(httpClient *apitools.HTTPClientWrapper, credentials LoginCredentials, adapter loginAdapter) (authStrategy, error) {
+	if resp, err := httpClient.GET(nil, nil, nil, "api", "host", "getVersion.json"); err != nil {
+		return nil, err
+	} else {
+		defer resp.Body.Close()
+
+		var version Version
+
+		if resp.StatusCode == http.StatusOK {
+			if content, err := ioutil.ReadAll(resp.Body); err == nil && json.Unmarshal(content, &version) == nil && len(version.ServiceVersion) > 0 {
+				log.Infof("Zoneminder %s does not require authentication", version.ServiceVersion)
+				return &noAuth{}, nil
+			}
+		}
+	}
+
+	if loginDetails, err := postLogin(httpClient, credentials, adapter()); err != nil {
+		return nil, err
+	} else if len(loginDetails.AccessToken) > 0 {
+		log.Infof("Zoneminder API %s supports token authentication", loginDetails.APIVersion)
+
+		return &tokenAuth{
+			httpClient:   httpClient,
+			credentials:  credentials,
+			adapter:      adapter,
+			loginSession: newLoginSession(loginDetails),
+		}, nil
+	} else if len(loginDetails.Credentials) > 0 {
+		log.Infof("Zoneminder API %s supports only legacy auth hash authentication", loginDetails.APIVersion)
+
+		strategy := &authHashAuth{
+			httpClient:  httpClient,
+			credentials: credentials,
+			adapter:     adapter,
+		}
+
+		return strategy, strategy.useLogin(loginDetails)
+	}
+
+	return nil, fmt.Errorf("unable to detect a supported zoneminder authentication mode")
+}
+
+func newLoginSession(details LoginDetails) *LoginSession {
+	now := time.Now()
+
+	return &LoginSession{
+		Details:     details,
+		Created:     now,
+		LastRefresh: now,
+	}
+}
+
+// postLogin logs in with the request and response format of the given release
+func postLogin(httpClient *apitools.HTTPClientWrapper, credentials LoginCredentials, adapter versionAdapter) (LoginDetails, error) {
+	var (
+		form   = adapter.LoginForm(credentials)
+		header = make(http.Header)
+	)
+
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if resp, err := httpClient.POST(strings.NewReader(form.Encode()), nil, header, "api", "host", "login.json"); err != nil {
+		return LoginDetails{}, err
+	} else {
+		defer resp.Body.Close()
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return LoginDetails{}, fmt.Errorf("request failed with response code %s", resp.Status)
+		}
+
+		if content, err := ioutil.ReadAll(resp.Body); err != nil {
+			return LoginDetails{}, err
+		} else {
+			return adapter.ParseLogin(content)
+		}
+	}
+}
+
+type noAuth struct{}
+
+func (s *noAuth) Mode() AuthMode {
+	return AuthModeNone
+}
+
+func (s *noAuth) Login() error {
+	return nil
+}
+
+func (s *noAuth) RefreshLogin() error {
+	return nil
+}
+
+func (s *noAuth) CheckLogin() error {
+	return nil
+}
+
+func (s *noAuth) Session() LoginSession {
+	return LoginSession{}
+}
+
+func (s *noAuth) Apply(query url.Values) {
+}
+
+type apiKeyAuth struct {
+	apiKey string
+}
+
+func (s *apiKeyAuth) Mode() AuthMode {
+	return AuthModeAPIKey
+}
+
+func (s *apiKeyAuth) Login() error {
+	return nil
+}
+
+func (s *apiKeyAuth) RefreshLogin() error {
+	return nil
+}
+
+func (s *apiKeyAuth) CheckLogin() error {
+	return nil
+}
+
+func (s *apiKeyAuth) Session() LoginSession {
+	return LoginSession{
+		Details: LoginDetails{
+			AccessToken: s.apiKey,
+		},
+	}
+}
+
+func (s *apiKeyAuth) Apply(query url.Values) {
+	if _, hasToken := query["token"]; !hasToken {
+		query.Set("token", s.apiKey)
+	}
+}
+
+type tokenAuth struct {
+	httpClient   *apitools.HTTPClientWrapper
+	credentials  LoginCredentials
+	adapter      loginAdapter
+	loginSession *LoginSession
+}
+
+func (s *tokenAuth) Mode() AuthMode {
+	return AuthModeToken
+}
+
+func (s *tokenAuth) Login() error {
+	if loginDetails, err := postLogin(s.httpClient, s.credentials, s.adapter()); err != nil {
+		return err
+	} else if len(loginDetails.AccessToken) == 0 {
+		return fmt.Errorf("zoneminder login response did not contain an access token")
+	} else {
+		s.loginSession = newLoginSession(loginDetails)
+	}
+
+	return nil
+}
+
+func (s *tokenAuth) RefreshLogin() error {
+	if s.loginSession == nil {
+		return s.Login()
+	}
+
+	query := url.Values{
+		"token": []string{s.loginSession.Details.RefreshToken},
+	}
+
+	if resp, err := s.httpClient.GET(nil, query, nil, "api", "host", "login.json"); err != nil {
+		return err
+	} else {
+		defer resp.Body.Close()
+
+		if content, err := ioutil.ReadAll(resp.Body); err != nil {
+			return err
+		} else if refreshDetails, err := s.adapter().ParseLogin(content); err != nil {
+			return err
+		} else {
+			s.loginSession.Refresh(refreshDetails)
+		}
+	}
+
+	return nil
+}
+
+func (s *tokenAuth) CheckLogin() error {
+	if s.loginSession == nil {
+		return s.Login()
+	}
+
+	if s.loginSession.Expired() {
+		return s.Login()
+	}
+
+	if s.loginSession.RefreshRequired() {
+		return s.RefreshLogin()
+	}
+
+	return nil
+}
+
+func (s *tokenAuth) Session() LoginSession {
+	if s.loginSession == nil {
+		return LoginSession{}
+	}
+
+	return *s.loginSession
+}
+
+func (s *tokenAuth) Apply(query url.Values) {
+	if _, hasToken := query["token"]; !hasToken && s.loginSession != nil {
+		query.Set("token", s.loginSession.Details.AccessToken)
+	}
+}
+
+type authHashAuth struct {
+	httpClient   *apitools.HTTPClientWrapper
+	credentials  LoginCredentials
+	adapter      loginAdapter
+	loginSession *LoginSession
+	authValues   url.Values
+}
+
+func (s *authHashAuth) Mode() AuthMode {
+	return AuthModeAuthHash
+}
+
+func (s *authHashAuth) Login() error {
+	if loginDetails, err := postLogin(s.httpClient, s.credentials, s.adapter()); err != nil {
+		return err
+	} else {
+		return s.useLogin(loginDetails)
+	}
+}
+
+func (s *authHashAuth) useLogin(loginDetails LoginDetails) error {
+	if len(loginDetails.Credentials) == 0 {
+		return fmt.Errorf("zoneminder login response did not contain auth hash credentials")
+	} else if authValues, err := url.ParseQuery(loginDetails.Credentials); err != nil {
+		return fmt.Errorf("failed to parse auth hash credentials: %w", err)
+	} else {
+		// Zoneminder expects the password to be appended when AUTH_RELAY is set to plain
+		if loginDetails.AppendPassword == 1 {
+			authValues.Set("pass", s.credentials.Password)
+		}
+
+		s.authValues = authValues
+		s.loginSession = newLoginSession(loginDetails)
+	}
+
+	return nil
+}
+
+func (s *authHashAuth) RefreshLogin() error {
+	return s.Login()
+}
+
+func (s *authHashAuth) CheckLogin() error {
+	if s.loginSession == nil || s.authValues == nil || time.Since(s.loginSession.Created) > authHashRefreshInterval {
+		return s.Login()
+	}
+
+	return nil
+}
+
+func (s *authHashAuth) Session() LoginSession {
+	if s.loginSession == nil {
+		return LoginSession{}
+	}
+
+	return *s.loginSession
+}
+
+func (s *authHashAuth) Apply(query url.Values) {
+	for key, values := range s.authValues {
+		if _, hasKey := query[key]; !hasKey {
+			query[key] = values
+		}
+	}
+}
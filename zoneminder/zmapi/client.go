@@ -10,76 +10,436 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/zinic/forculus/apitools"
+	"github.com/zinic/forculus/log"
 
 	"github.com/zinic/forculus/zoneminder/constants"
 	"golang.org/x/net/html"
 )
 
+// EventExporter is the subset of the client used to retrieve event contents
+type EventExporter interface {
+	ExportEvent(event MonitorEvent, options ExportOptions) (io.ReadCloser, error)
+	DownloadMP4(event MonitorEvent) (io.ReadCloser, error)
+}
+
 type Client interface {
+	EventExporter
+	Name() string
 	Login() error
 	LoginSession() LoginSession
+	AuthMode() AuthMode
 	RefreshLogin() error
 	Monitors() (MonitorList, error)
-	ExportEvent(event MonitorEvent) (io.ReadCloser, error)
-	DownloadMP4(event MonitorEvent) (io.ReadCloser, error)
 	AlarmStatus(monitor Monitor) (AlarmStatus, error)
+	Snapshot(monitor Monitor) (Snapshot, error)
+	Zones() (ZoneList, error)
+	Groups() (GroupList, error)
+	Logs(page int) (LogPage, error)
 	ListEvents() (EventList, error)
 	ListEventsBetween(start, end time.Time) (EventList, error)
 	ListMonitorEvents(monitorID string, start, end time.Time) (EventList, error)
+	ListEventsAfter(eventID int64) (EventList, error)
+	LatestEventID() (int64, error)
+	Event(eventID string) (MonitorEvent, error)
 	Version() (Version, error)
-	AlertedMonitors() (map[string]AlertedMonitor, []error)
+	CheckCompatibility() (CompatibilityReport, error)
+	AlertedMonitors(monitors MonitorList, workers int) (map[string]AlertedMonitor, []error)
+	HostLoad() (HostLoad, error)
+	HostDiskPercent() (HostDiskPercent, error)
+	DaemonCheck() (DaemonCheckResult, error)
+	StorageAreas() (StorageList, error)
+	RunStates() (RunStateList, error)
+	ChangeRunState(name string) error
+	ControlDaemons(command DaemonCommand) error
+	TimeZone() *time.Location
 }
 
-func NewClient(endpoint apitools.Endpoint, credentials LoginCredentials) Client {
+// NewClient creates a Zoneminder API client. Event times are interpreted in the
+// given location; when it is nil the server's timezone is detected during the
+// compatibility check.
+func NewClient(name string, endpoint apitools.Endpoint, httpClient *http.Client, credentials LoginCredentials, location *time.Location) Client {
 	return &client{
-		credentials: credentials,
-		httpClient:  apitools.NewHTTPClientWrapper(endpoint),
+		name:               name,
+		credentials:        credentials,
+		location:           location,
+		timeZoneConfigured: location != nil,
+		cacheLock:          &sync.Mutex{},
+		authLock:           &sync.RWMutex{},
+		stateLock:          &sync.RWMutex{},
+		httpClient:         apitools.NewHTTPClientWrapper(endpoint, httpClient),
 	}
 }
 
 type client struct {
-	credentials  LoginCredentials
-	loginSession *LoginSession
-	httpClient   *apitools.HTTPClientWrapper
+	name               string
+	credentials        LoginCredentials
+	auth               authStrategy
+	adapter            versionAdapter
+	compatibility      *CompatibilityReport
+	location           *time.Location
+	timeZoneConfigured bool
+	zones              ZoneList
+	zonesLoaded        time.Time
+	monitorGroups      map[string][]string
+	groupsLoaded       time.Time
+	groupsFailing      bool
+	cacheLock          *sync.Mutex
+	httpClient         *apitools.HTTPClientWrapper
+
+	// The client is shared by every service watching the server. authLock
+	// guards the auth strategy and its session while stateLock guards what the
+	// compatibility check resolves.
+	authLock  *sync.RWMutex
+	stateLock *sync.RWMutex
 }
 
-func (s *client) doGET(body io.Reader, query url.Values, header http.Header, path ...string) (*http.Response, error) {
+func (s *client) applyAuth(query url.Values) url.Values {
 	queryCopy := apitools.CopyURLValues(query)
 
-	if _, hasToken := queryCopy["token"]; !hasToken && s.loginSession != nil {
-		queryCopy.Set("token", s.loginSession.Details.AccessToken)
+	s.authLock.RLock()
+	defer s.authLock.RUnlock()
+
+	if s.auth != nil {
+		s.auth.Apply(queryCopy)
 	}
 
-	return s.httpClient.GET(body, queryCopy, header, path...)
+	return queryCopy
+}
+
+func (s *client) doGET(body io.Reader, query url.Values, header http.Header, path ...string) (*http.Response, error) {
+	return s.httpClient.GET(body, s.applyAuth(query), header, path...)
 }
 
 func (s *client) doPOST(body io.Reader, query url.Values, header http.Header, path ...string) (*http.Response, error) {
-	queryCopy := apitools.CopyURLValues(query)
+	return s.httpClient.POST(body, s.applyAuth(query), header, path...)
+}
 
-	if _, hasToken := queryCopy["token"]; !hasToken && s.loginSession != nil {
-		queryCopy.Set("token", s.loginSession.Details.AccessToken)
+// initAuth resolves the configured auth strategy. When the mode is set to auto
+// this probes the server, which also performs the initial login. The caller
+// must hold the auth lock.
+func (s *client) initAuth() (bool, error) {
+	if s.auth != nil {
+		return false, nil
 	}
 
-	return s.httpClient.POST(body, queryCopy, header, path...)
+	if strategy, err := newAuthStrategy(s.httpClient, s.credentials, s.loginAdapter); err != nil {
+		return false, err
+	} else {
+		s.auth = strategy
+	}
+
+	return s.credentials.Mode == AuthModeAuto, nil
 }
 
 func (s *client) checkLogin() error {
-	if s.loginSession == nil {
-		return s.Login()
+	s.authLock.Lock()
+	defer s.authLock.Unlock()
+
+	if _, err := s.initAuth(); err != nil {
+		return err
 	}
 
-	if s.loginSession.Expired() {
-		return s.Login()
+	return s.auth.CheckLogin()
+}
+
+// CheckCompatibility detects the Zoneminder release and selects the adapter
+// used for version specific API calls. The result is cached after the first
+// successful detection.
+func (s *client) CheckCompatibility() (CompatibilityReport, error) {
+	s.stateLock.RLock()
+	compatibility, location := s.compatibility, s.location
+	s.stateLock.RUnlock()
+
+	if compatibility != nil {
+		return *compatibility, nil
 	}
 
-	if s.loginSession.RefreshRequired() {
-		return s.RefreshLogin()
+	report := CompatibilityReport{
+		Server: s.name,
 	}
 
-	return nil
+	version, err := s.Version()
+	if err != nil {
+		return report, fmt.Errorf("failed to detect version of zoneminder server %s: %w", s.name, err)
+	}
+
+	report.ServerVersion = version.ServiceVersion
+	report.APIVersion = version.APIVersion
+	report.AuthMode = s.AuthMode()
+
+	timeZoneFallback := false
+
+	if location != nil && s.timeZoneConfigured {
+		report.TimeZoneSource = TimeZoneConfigured
+	} else if location != nil {
+		report.TimeZoneSource = TimeZoneDetected
+	} else if detected, err := s.detectTimeZone(); err != nil {
+		// The process timezone is not kept so that the next check detects
+		// the server timezone again
+		location = time.Local
+		timeZoneFallback = true
+		report.TimeZoneSource = fmt.Sprintf("%s (%v)", TimeZoneFallback, err)
+	} else {
+		location = detected
+		report.TimeZoneSource = TimeZoneDetected
+	}
+
+	report.TimeZone = location.String()
+
+	var selectedAdapter versionAdapter
+
+	if serverVersion, err := ParseServerVersion(version.ServiceVersion); err != nil {
+		report.Issues = append(report.Issues, err.Error())
+	} else if adapter, supported := selectVersionAdapter(serverVersion); !supported {
+		report.Issues = append(report.Issues, fmt.Sprintf("zoneminder %s is older than the oldest supported release 1.32", serverVersion))
+	} else {
+		report.Adapter = adapter.Name()
+		report.MonitorStatus = adapter.MonitorStatus()
+
+		authSupported := false
+		for _, authMode := range adapter.AuthModes() {
+			if authMode == report.AuthMode {
+				authSupported = true
+				break
+			}
+		}
+
+		if !authSupported {
+			report.Issues = append(report.Issues, fmt.Sprintf("auth mode %s is not supported by zoneminder %s", report.AuthMode, adapter.Name()))
+		} else {
+			selectedAdapter = adapter
+		}
+	}
+
+	// Detection happens without holding the lock so that concurrent callers
+	// may race to check; they all arrive at the same result
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	if !timeZoneFallback {
+		s.location = location
+	}
+
+	if selectedAdapter != nil {
+		s.adapter = selectedAdapter
+	}
+
+	if !report.Compatible() {
+		return report, IncompatibleServerError{
+			Report: report,
+		}
+	}
+
+	// Reports relying on the fallback timezone are not kept so that the
+	// compatibility check runs again
+	if !timeZoneFallback {
+		s.compatibility = &report
+	}
+	return report, nil
+}
+
+// detectTimeZone asks Zoneminder for its configured timezone, first through the
+// host API and then through the ZM_TIMEZONE option
+func (s *client) detectTimeZone() (*time.Location, error) {
+	var (
+		timeZoneResponse TimeZoneResponse
+		configResponse   ViewConfigResponse
+		timeZone         string
+	)
+
+	if err := s.getJSON(nil, &timeZoneResponse, "api", "host", "getTimeZone.json"); err == nil && len(timeZoneResponse.TimeZone) > 0 {
+		timeZone = timeZoneResponse.TimeZone
+	} else if err := s.getJSON(nil, &configResponse, "api", "configs", "viewByName", "ZM_TIMEZONE.json"); err != nil {
+		return nil, fmt.Errorf("failed to read timezone: %w", err)
+	} else if len(configResponse.Config.Value) > 0 {
+		timeZone = configResponse.Config.Value
+	} else {
+		return nil, fmt.Errorf("zoneminder has no timezone configured")
+	}
+
+	return time.LoadLocation(timeZone)
+}
+
+// TimeZone returns the location Zoneminder timestamps are interpreted in. This
+// is the process timezone until the server's timezone has been resolved.
+func (s *client) TimeZone() *time.Location {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	if s.location == nil {
+		return time.Local
+	}
+
+	return s.location
+}
+
+// normalizeEvent fills in the fields of an event that depend on the server it
+// was read from
+func (s *client) normalizeEvent(adapter versionAdapter, monitorEvent *MonitorEvent) {
+	adapter.NormalizeEvent(monitorEvent)
+
+	monitorEvent.Server = s.name
+	monitorEvent.Location = s.TimeZone()
+	monitorEvent.Zones = ParseTriggeredZones(monitorEvent.Notes, s.cachedZones().Names(monitorEvent.MonitorID))
+	monitorEvent.Groups = s.cachedMonitorGroups()[monitorEvent.MonitorID]
+}
+
+const metadataCacheTTL = time.Minute * 5
+
+// cachedZones returns the zone list, refreshing it when it is older than the
+// metadata cache TTL. Zone names only help parse event notes so failures are
+// not fatal and leave the cache stale so the next event retries.
+func (s *client) cachedZones() ZoneList {
+	s.cacheLock.Lock()
+	zones, stale := s.zones, time.Since(s.zonesLoaded) >= metadataCacheTTL
+	s.cacheLock.Unlock()
+
+	if !stale {
+		return zones
+	}
+
+	// The cache lock is not held while fetching so that a slow server does
+	// not block every other reader of the cache
+	if fetched, err := s.Zones(); err != nil {
+		log.Debugf("Failed to list zones from %s: %v", s.name, err)
+	} else {
+		zones = fetched
+
+		s.cacheLock.Lock()
+		s.zones = fetched
+		s.zonesLoaded = time.Now()
+		s.cacheLock.Unlock()
+	}
+
+	return zones
+}
+
+// cachedMonitorGroups returns the group membership of every monitor,
+// refreshing it when it is older than the metadata cache TTL. Failures leave
+// the cache stale so the next event retries.
+func (s *client) cachedMonitorGroups() map[string][]string {
+	s.cacheLock.Lock()
+	monitorGroups, stale := s.monitorGroups, time.Since(s.groupsLoaded) >= metadataCacheTTL
+	s.cacheLock.Unlock()
+
+	if !stale {
+		return monitorGroups
+	}
+
+	if groups, err := s.Groups(); err != nil {
+		log.Debugf("Failed to list monitor groups from %s: %v", s.name, err)
+	} else {
+		monitorGroups = groups.MonitorGroups()
+
+		s.cacheLock.Lock()
+		s.monitorGroups = monitorGroups
+		s.groupsLoaded = time.Now()
+		s.cacheLock.Unlock()
+	}
+
+	return monitorGroups
+}
+
+// Groups lists every monitor group along with its member monitors
+func (s *client) Groups() (GroupList, error) {
+	var listGroupsResponse ListGroupsResponse
+
+	if err := s.getJSON(nil, &listGroupsResponse, "api", "groups.json"); err != nil {
+		return nil, err
+	}
+
+	return listGroupsResponse.Groups, nil
+}
+
+// Zones lists the zones of every monitor
+func (s *client) Zones() (ZoneList, error) {
+	var listZonesResponse ListZonesResponse
+
+	if err := s.getJSON(nil, &listZonesResponse, "api", "zones.json"); err != nil {
+		return nil, err
+	}
+
+	zones := make(ZoneList, 0, len(listZonesResponse.Zones))
+	for _, zoneWrapper := range listZonesResponse.Zones {
+		zones = append(zones, zoneWrapper.Zone)
+	}
+
+	return zones, nil
+}
+
+// Logs reads a page of Zoneminder's log. Pages start at 1 and are ordered from
+// the newest log line to the oldest.
+func (s *client) Logs(page int) (LogPage, error) {
+	var (
+		listLogsResponse ListLogsResponse
+		query            = url.Values{
+			"page":      []string{strconv.Itoa(page)},
+			"sort":      []string{"TimeKey"},
+			"direction": []string{"desc"},
+		}
+	)
+
+	if err := s.getJSON(query, &listLogsResponse, "api", "logs.json"); err != nil {
+		return LogPage{}, err
+	}
+
+	logPage := LogPage{
+		Entries:  make(LogList, 0, len(listLogsResponse.Logs)),
+		NextPage: listLogsResponse.Pagination.NextPage,
+	}
+
+	for _, logWrapper := range listLogsResponse.Logs {
+		logPage.Entries = append(logPage.Entries, logWrapper.Log)
+	}
+
+	return logPage, nil
+}
+
+// loginAdapter returns the adapter that handles logins. Logging in comes before
+// the release can be detected, so the newest adapter is used until then.
+func (s *client) loginAdapter() versionAdapter {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	if s.adapter == nil {
+		return versionAdapters[0]
+	}
+
+	return s.adapter
+}
+
+func (s *client) versionAdapter() (versionAdapter, error) {
+	s.stateLock.RLock()
+	adapter := s.adapter
+	s.stateLock.RUnlock()
+
+	if adapter != nil {
+		return adapter, nil
+	}
+
+	if _, err := s.CheckCompatibility(); err != nil {
+		return nil, err
+	}
+
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	return s.adapter, nil
+}
+
+func (s *client) AuthMode() AuthMode {
+	s.authLock.RLock()
+	defer s.authLock.RUnlock()
+
+	if s.auth == nil {
+		return s.credentials.Mode
+	}
+
+	return s.auth.Mode()
 }
 
 func (s *client) exportEventCSRF(event MonitorEvent) (string, error) {
@@ -103,15 +463,31 @@ func (s *client) exportEventCSRF(event MonitorEvent) (string, error) {
 	}
 }
 
+func (s *client) Name() string {
+	return s.name
+}
+
 func (s *client) LoginSession() LoginSession {
-	return *s.loginSession
+	s.authLock.RLock()
+	defer s.authLock.RUnlock()
+
+	if s.auth == nil {
+		return LoginSession{}
+	}
+
+	return s.auth.Session()
 }
 
-func (s *client) ExportEvent(event MonitorEvent) (io.ReadCloser, error) {
+func (s *client) ExportEvent(event MonitorEvent, options ExportOptions) (io.ReadCloser, error) {
 	if err := s.checkLogin(); err != nil {
 		return nil, err
 	}
 
+	adapter, err := s.versionAdapter()
+	if err != nil {
+		return nil, err
+	}
+
 	var (
 		connKey = strconv.Itoa(rand.Int() % 1000000)
 		form    = url.Values{
@@ -120,13 +496,13 @@ func (s *client) ExportEvent(event MonitorEvent) (io.ReadCloser, error) {
 			"action":         []string{"export"},
 			"connkey":        []string{connKey},
 			"eids[]":         []string{event.ID},
-			"exportDetail":   []string{"1"},
-			"exportFrames":   []string{"1"},
-			"exportImages":   []string{"1"},
-			"exportVideo":    []string{"1"},
-			"exportMisc":     []string{"1"},
-			"exportFormat":   []string{"tar"},
-			"exportCompress": []string{"1"},
+			"exportDetail":   []string{formatExportFlag(options.Detail)},
+			"exportFrames":   []string{formatExportFlag(options.Frames)},
+			"exportImages":   []string{formatExportFlag(options.Images)},
+			"exportVideo":    []string{formatExportFlag(options.Video)},
+			"exportMisc":     []string{formatExportFlag(options.Misc)},
+			"exportFormat":   []string{string(options.Format)},
+			"exportCompress": []string{formatExportFlag(options.Compress)},
 			"exportFile":     nil,
 			"generated":      nil,
 		}
@@ -138,6 +514,8 @@ func (s *client) ExportEvent(event MonitorEvent) (io.ReadCloser, error) {
 		exportEventResult ExportEventResult
 	)
 
+	adapter.ExportForm(event, options, form)
+
 	// Gross...
 	if csrfToken, err := s.exportEventCSRF(event); err != nil {
 		return nil, err
@@ -183,40 +561,108 @@ func (s *client) DownloadMP4(event MonitorEvent) (io.ReadCloser, error) {
 
 	if resp, err := s.doGET(nil, params, nil, "index.php"); err != nil {
 		return nil, err
+	} else if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		return nil, fmt.Errorf("request failed with response code %s", resp.Status)
 	} else {
 		return resp.Body, nil
 	}
 }
 
-func (s *client) AlertedMonitors() (map[string]AlertedMonitor, []error) {
+// Snapshot grabs a single JPEG frame from the live stream of the monitor
+func (s *client) Snapshot(monitor Monitor) (Snapshot, error) {
+	const maxSnapshotSize = 16 * 1024 * 1024
+
+	if err := s.checkLogin(); err != nil {
+		return Snapshot{}, err
+	}
+
+	params := url.Values{
+		"mode":    []string{"single"},
+		"monitor": []string{monitor.Details.ID},
+		"scale":   []string{"100"},
+	}
+
+	if resp, err := s.doGET(nil, params, nil, "cgi-bin", "nph-zms"); err != nil {
+		return Snapshot{}, err
+	} else {
+		defer resp.Body.Close()
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return Snapshot{}, fmt.Errorf("request failed with response code %s", resp.Status)
+		} else if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "image/") {
+			return Snapshot{}, fmt.Errorf("expected an image from the stream server but got %s", contentType)
+		} else if image, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSnapshotSize)); err != nil {
+			return Snapshot{}, err
+		} else {
+			return Snapshot{
+				Monitor:     monitor,
+				ContentType: contentType,
+				Image:       image,
+				CapturedAt:  time.Now(),
+			}, nil
+		}
+	}
+}
+
+// AlertedMonitors polls the alarm status of the given monitors with at most
+// workers requests in flight and returns the monitors that are alarmed.
+// Monitors that cannot raise alarms are skipped.
+func (s *client) AlertedMonitors(monitors MonitorList, workers int) (map[string]AlertedMonitor, []error) {
+	if err := s.checkLogin(); err != nil {
+		return nil, []error{err}
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
 	var (
 		errorList       []error
-		changedMonitors = make(map[string]AlertedMonitor)
+		alertedMonitors = make(map[string]AlertedMonitor)
+		resultsLock     = &sync.Mutex{}
+		monitorC        = make(chan Monitor)
+		waitGroup       = &sync.WaitGroup{}
 	)
 
-	if monitors, err := s.Monitors(); err != nil {
-		return nil, []error{err}
-	} else {
-		for _, monitor := range monitors {
-			if alarmStatus, err := s.AlarmStatus(monitor); err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to fetch alarm status for monitor %s: %w", monitor.Name(), err))
-			} else {
-				switch alarmStatus {
-				case AlarmStatusPreAlarm:
-					fallthrough
-				case AlarmStatusAlert:
-					fallthrough
-				case AlarmStatusAlarm:
-					changedMonitors[monitor.Details.ID] = AlertedMonitor{
-						Monitor:     monitor,
-						AlarmStatus: alarmStatus,
+	for worker := 0; worker < workers; worker++ {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			for monitor := range monitorC {
+				alarmStatus, err := s.alarmStatus(monitor)
+
+				resultsLock.Lock()
+
+				if err != nil {
+					errorList = append(errorList, fmt.Errorf("failed to fetch alarm status for monitor %s: %w", monitor.Name(), err))
+				} else {
+					switch alarmStatus {
+					case AlarmStatusPreAlarm, AlarmStatusAlert, AlarmStatusAlarm:
+						alertedMonitors[monitor.Details.ID] = AlertedMonitor{
+							Monitor:     monitor,
+							AlarmStatus: alarmStatus,
+						}
 					}
 				}
+
+				resultsLock.Unlock()
 			}
+		}()
+	}
+
+	for _, monitor := range monitors {
+		if monitor.Active() {
+			monitorC <- monitor
 		}
 	}
 
-	return changedMonitors, errorList
+	close(monitorC)
+	waitGroup.Wait()
+
+	return alertedMonitors, errorList
 }
 
 func (s *client) Monitors() (MonitorList, error) {
@@ -237,6 +683,39 @@ func (s *client) Monitors() (MonitorList, error) {
 		}
 	}
 
+	// Group membership is only metadata so monitors are still listed with
+	// the last known groups when the server refuses to list them, as older
+	// servers and restricted users do
+	var monitorGroups map[string][]string
+
+	if groups, err := s.Groups(); err != nil {
+		s.cacheLock.Lock()
+		if !s.groupsFailing {
+			log.Warnf("Failed to list monitor groups from %s; using the last known groups: %v", s.name, err)
+			s.groupsFailing = true
+		} else {
+			log.Debugf("Failed to list monitor groups from %s: %v", s.name, err)
+		}
+
+		monitorGroups = s.monitorGroups
+		s.cacheLock.Unlock()
+	} else {
+		monitorGroups = groups.MonitorGroups()
+
+		s.cacheLock.Lock()
+		s.monitorGroups = monitorGroups
+		s.groupsLoaded = time.Now()
+		s.groupsFailing = false
+		s.cacheLock.Unlock()
+	}
+
+	for idx := range listMonitorsResponse.Monitors {
+		monitor := &listMonitorsResponse.Monitors[idx]
+
+		monitor.Server = s.name
+		monitor.Groups = monitorGroups[monitor.Details.ID]
+	}
+
 	return listMonitorsResponse.Monitors, nil
 }
 
@@ -245,6 +724,12 @@ func (s *client) AlarmStatus(monitor Monitor) (AlarmStatus, error) {
 		return AlarmStatusInvalid, err
 	}
 
+	return s.alarmStatus(monitor)
+}
+
+// alarmStatus queries the alarm status of a monitor without checking the
+// login so that it may be called concurrently
+func (s *client) alarmStatus(monitor Monitor) (AlarmStatus, error) {
 	var monitorAlarmStatus MonitorAlarmStatus
 	if resp, err := s.doGET(nil, nil, nil, "api", "monitors", "alarm", fmt.Sprintf("id:%s", monitor.Details.ID), "command:status.json"); err != nil {
 		return AlarmStatusInvalid, err
@@ -261,27 +746,25 @@ func (s *client) AlarmStatus(monitor Monitor) (AlarmStatus, error) {
 	return ParseAlarmStatus(monitorAlarmStatus.Status), nil
 }
 
-func (s *client) ListMonitorEvents(monitorID string, start, end time.Time) (EventList, error) {
-	if err := s.checkLogin(); err != nil {
+func (s *client) listEvents(baseQuery url.Values, path ...string) (EventList, error) {
+	adapter, err := s.versionAdapter()
+	if err != nil {
 		return nil, err
 	}
 
 	var (
-		listEventsResponse ListEventsResponse
-		events             EventList
-
-		monitorPath = fmt.Sprintf("MonitorId:%s", monitorID)
-		startTime   = fmt.Sprintf("StartTime >=:%s", start.Format(constants.ZMDateFormat))
-		endTime     = fmt.Sprintf("EndTime <=:%s.json", end.Format(constants.ZMDateFormat))
-		query       = url.Values{}
-		page        = 1
+		events EventList
+		query  = apitools.CopyURLValues(baseQuery)
+		page   = 1
 	)
 
 	for {
+		var listEventsResponse ListEventsResponse
+
 		query.Set("page", strconv.Itoa(page))
 		page += 1
 
-		if resp, err := s.doGET(nil, query, nil, "api", "events", "index", monitorPath, startTime, endTime); err != nil {
+		if resp, err := s.doGET(nil, query, nil, path...); err != nil {
 			return nil, err
 		} else if content, err := ioutil.ReadAll(resp.Body); err != nil {
 			resp.Body.Close()
@@ -293,6 +776,8 @@ func (s *client) ListMonitorEvents(monitorID string, start, end time.Time) (Even
 			resp.Body.Close()
 
 			for _, eventWrapper := range listEventsResponse.Events {
+				s.normalizeEvent(adapter, &eventWrapper.Event)
+
 				events = append(events, eventWrapper.Event)
 			}
 
@@ -305,88 +790,116 @@ func (s *client) ListMonitorEvents(monitorID string, start, end time.Time) (Even
 	return events, nil
 }
 
-func (s *client) ListEventsBetween(start, end time.Time) (EventList, error) {
+func (s *client) eventTimeFilters(start, end time.Time) ([]string, error) {
+	if adapter, err := s.versionAdapter(); err != nil {
+		return nil, err
+	} else {
+		var (
+			startField, endField = adapter.EventTimeFields()
+			location             = s.TimeZone()
+		)
+
+		return []string{
+			fmt.Sprintf("%s >=:%s", startField, start.In(location).Format(constants.ZMDateFormat)),
+			fmt.Sprintf("%s <=:%s.json", endField, end.In(location).Format(constants.ZMDateFormat)),
+		}, nil
+	}
+}
+
+func (s *client) ListMonitorEvents(monitorID string, start, end time.Time) (EventList, error) {
 	if err := s.checkLogin(); err != nil {
 		return nil, err
 	}
 
-	var (
-		listEventsResponse ListEventsResponse
-		events             EventList
+	if timeFilters, err := s.eventTimeFilters(start, end); err != nil {
+		return nil, err
+	} else {
+		path := append([]string{"api", "events", "index", fmt.Sprintf("MonitorId:%s", monitorID)}, timeFilters...)
+		return s.listEvents(nil, path...)
+	}
+}
 
-		startTime = fmt.Sprintf("StartTime >=:%s", start.Format(constants.ZMDateFormat))
-		endTime   = fmt.Sprintf("EndTime <=:%s.json", end.Format(constants.ZMDateFormat))
-		query     = url.Values{}
-		page      = 1
-	)
+func (s *client) ListEventsBetween(start, end time.Time) (EventList, error) {
+	if err := s.checkLogin(); err != nil {
+		return nil, err
+	}
 
-	for {
-		query.Set("page", strconv.Itoa(page))
-		page += 1
+	if timeFilters, err := s.eventTimeFilters(start, end); err != nil {
+		return nil, err
+	} else {
+		path := append([]string{"api", "events", "index"}, timeFilters...)
+		return s.listEvents(nil, path...)
+	}
+}
 
-		if resp, err := s.doGET(nil, query, nil, "api", "events", "index", startTime, endTime); err != nil {
-			return nil, err
-		} else if content, err := ioutil.ReadAll(resp.Body); err != nil {
-			resp.Body.Close()
-			return nil, err
-		} else if err := json.Unmarshal(content, &listEventsResponse); err != nil {
-			resp.Body.Close()
-			return nil, err
-		} else {
-			resp.Body.Close()
+func (s *client) Event(eventID string) (MonitorEvent, error) {
+	var viewEventResponse ViewEventResponse
 
-			for _, eventWrapper := range listEventsResponse.Events {
-				events = append(events, eventWrapper.Event)
-			}
+	adapter, err := s.versionAdapter()
+	if err != nil {
+		return MonitorEvent{}, err
+	}
 
-			if !listEventsResponse.Pagination.NextPage {
-				break
-			}
-		}
+	if err := s.getJSON(nil, &viewEventResponse, "api", "events", fmt.Sprintf("%s.json", eventID)); err != nil {
+		return MonitorEvent{}, err
 	}
 
-	return events, nil
+	monitorEvent := viewEventResponse.Event.Event
+	s.normalizeEvent(adapter, &monitorEvent)
+
+	return monitorEvent, nil
 }
 
-func (s *client) ListEvents() (EventList, error) {
+// ListEventsAfter lists every event with an ID greater than the given event ID
+// in ascending ID order
+func (s *client) ListEventsAfter(eventID int64) (EventList, error) {
 	if err := s.checkLogin(); err != nil {
 		return nil, err
 	}
 
+	query := url.Values{
+		"sort":      []string{"Id"},
+		"direction": []string{"asc"},
+	}
+
+	return s.listEvents(query, "api", "events", "index", fmt.Sprintf("Id >:%d.json", eventID))
+}
+
+// LatestEventID returns the highest event ID on the server, or zero when the
+// server has no events at all
+func (s *client) LatestEventID() (int64, error) {
 	var (
+		latestEventID      int64
 		listEventsResponse ListEventsResponse
-		events             EventList
-
-		query = url.Values{}
-		page  = 1
+		query              = url.Values{
+			"sort":      []string{"Id"},
+			"direction": []string{"desc"},
+			"limit":     []string{"1"},
+		}
 	)
 
-	for {
-		query.Set("page", strconv.Itoa(page))
-		page += 1
+	if err := s.getJSON(query, &listEventsResponse, "api", "events", "index.json"); err != nil {
+		return 0, err
+	}
 
-		if resp, err := s.doGET(nil, query, nil, "api", "events.json"); err != nil {
-			return nil, err
-		} else if content, err := ioutil.ReadAll(resp.Body); err != nil {
-			resp.Body.Close()
-			return nil, err
-		} else if err := json.Unmarshal(content, &listEventsResponse); err != nil {
-			resp.Body.Close()
-			return nil, err
-		} else {
-			resp.Body.Close()
+	// The whole page is checked in case the server ignores the sort order
+	for _, eventWrapper := range listEventsResponse.Events {
+		if eventID, err := eventWrapper.Event.ParseID(); err != nil {
+			return 0, fmt.Errorf("failed to parse ID of event %s: %w", eventWrapper.Event.ID, err)
+		} else if eventID > latestEventID {
+			latestEventID = eventID
+		}
+	}
 
-			for _, eventWrapper := range listEventsResponse.Events {
-				events = append(events, eventWrapper.Event)
-			}
+	return latestEventID, nil
+}
 
-			if !listEventsResponse.Pagination.NextPage {
-				break
-			}
-		}
+func (s *client) ListEvents() (EventList, error) {
+	if err := s.checkLogin(); err != nil {
+		return nil, err
 	}
 
-	return events, nil
+	return s.listEvents(nil, "api", "events.json")
 }
 
 func (s *client) Version() (Version, error) {
@@ -411,43 +924,97 @@ func (s *client) Version() (Version, error) {
 	return version, nil
 }
 
-func (s *client) RefreshLogin() error {
-	query := url.Values{
-		"token": []string{s.loginSession.Details.RefreshToken},
+func (s *client) getJSON(query url.Values, target interface{}, path ...string) error {
+	if err := s.checkLogin(); err != nil {
+		return err
 	}
 
-	if resp, err := s.doGET(nil, query, nil, "api", "host", "login.json"); err != nil {
+	if resp, err := s.doGET(nil, query, nil, path...); err != nil {
 		return err
 	} else {
 		defer resp.Body.Close()
 
-		var refreshDetails LoginDetails
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("request failed with response code %s", resp.Status)
+		}
 
 		if content, err := ioutil.ReadAll(resp.Body); err != nil {
 			return err
-		} else if err := json.Unmarshal(content, &refreshDetails); err != nil {
-			return err
-		} else {
-			s.loginSession.Refresh(refreshDetails)
+		} else if err := json.Unmarshal(content, target); err != nil {
+			return fmt.Errorf("failed parsing %s: %w", content, err)
 		}
 	}
 
 	return nil
 }
 
-func (s *client) Login() error {
+func (s *client) HostLoad() (HostLoad, error) {
+	var hostLoad HostLoad
+	return hostLoad, s.getJSON(nil, &hostLoad, "api", "host", "getLoad.json")
+}
+
+func (s *client) HostDiskPercent() (HostDiskPercent, error) {
+	var diskPercent HostDiskPercent
+	return diskPercent, s.getJSON(nil, &diskPercent, "api", "host", "getDiskPercent.json")
+}
+
+func (s *client) DaemonCheck() (DaemonCheckResult, error) {
+	var daemonCheck DaemonCheckResult
+	return daemonCheck, s.getJSON(nil, &daemonCheck, "api", "host", "daemonCheck.json")
+}
+
+func (s *client) StorageAreas() (StorageList, error) {
 	var (
-		form         = make(url.Values)
-		header       = make(http.Header)
-		loginDetails LoginDetails
+		listStorageResponse ListStorageResponse
+		storageAreas        StorageList
 	)
 
-	form.Set("user", s.credentials.Username)
-	form.Set("pass", s.credentials.Password)
+	if err := s.getJSON(nil, &listStorageResponse, "api", "storage.json"); err != nil {
+		return nil, err
+	}
+
+	for _, storageWrapper := range listStorageResponse.Storage {
+		storageAreas = append(storageAreas, storageWrapper.Storage)
+	}
+
+	return storageAreas, nil
+}
+
+func (s *client) RunStates() (RunStateList, error) {
+	if err := s.checkLogin(); err != nil {
+		return nil, err
+	}
+
+	var (
+		listRunStatesResponse ListRunStatesResponse
+		runStates             RunStateList
+	)
+
+	if resp, err := s.doGET(nil, nil, nil, "api", "states.json"); err != nil {
+		return nil, err
+	} else {
+		defer resp.Body.Close()
+
+		if content, err := ioutil.ReadAll(resp.Body); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(content, &listRunStatesResponse); err != nil {
+			return nil, err
+		}
+	}
 
-	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, runStateWrapper := range listRunStatesResponse.States {
+		runStates = append(runStates, runStateWrapper.State)
+	}
+
+	return runStates, nil
+}
 
-	if resp, err := s.doPOST(strings.NewReader(form.Encode()), nil, header, "api", "host", "login.json"); err != nil {
+func (s *client) changeState(value string) error {
+	if err := s.checkLogin(); err != nil {
+		return err
+	}
+
+	if resp, err := s.doPOST(nil, nil, nil, "api", "states", "change", fmt.Sprintf("%s.json", value)); err != nil {
 		return err
 	} else {
 		defer resp.Body.Close()
@@ -455,20 +1022,42 @@ func (s *client) Login() error {
 		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 			return fmt.Errorf("request failed with response code %s", resp.Status)
 		}
-
-		now := time.Now()
-		if content, err := ioutil.ReadAll(resp.Body); err != nil {
-			return err
-		} else if err := json.Unmarshal(content, &loginDetails); err != nil {
-			return err
-		} else {
-			s.loginSession = &LoginSession{
-				Details:     loginDetails,
-				Created:     now,
-				LastRefresh: now,
-			}
-		}
 	}
 
 	return nil
 }
+
+func (s *client) ChangeRunState(name string) error {
+	// ZoneMinder treats the daemon commands as reserved state names
+	if _, reserved := ParseDaemonCommand(name); reserved {
+		return fmt.Errorf("run state name %s is reserved for daemon control", name)
+	}
+
+	return s.changeState(name)
+}
+
+func (s *client) ControlDaemons(command DaemonCommand) error {
+	return s.changeState(string(command))
+}
+
+func (s *client) RefreshLogin() error {
+	s.authLock.Lock()
+	defer s.authLock.Unlock()
+
+	if _, err := s.initAuth(); err != nil {
+		return err
+	}
+
+	return s.auth.RefreshLogin()
+}
+
+func (s *client) Login() error {
+	s.authLock.Lock()
+	defer s.authLock.Unlock()
+
+	if loggedIn, err := s.initAuth(); err != nil || loggedIn {
+		return err
+	}
+
+	return s.auth.Login()
+}
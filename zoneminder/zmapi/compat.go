@@ -0,0 +1,233 @@
+package zmapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type ServerVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func ParseServerVersion(raw string) (ServerVersion, error) {
+	var (
+		version ServerVersion
+		parts   = strings.Split(strings.TrimSpace(raw), ".")
+		targets = []*int{&version.Major, &version.Minor, &version.Patch}
+	)
+
+	if len(parts) < 2 {
+		return version, fmt.Errorf("malformed zoneminder version %s", raw)
+	}
+
+	for idx := 0; idx < len(parts) && idx < len(targets); idx++ {
+		if value, err := strconv.Atoi(parts[idx]); err != nil {
+			return version, fmt.Errorf("malformed zoneminder version %s: %w", raw, err)
+		} else {
+			*targets[idx] = value
+		}
+	}
+
+	return version, nil
+}
+
+func (s ServerVersion) AtLeast(major, minor int) bool {
+	return s.Major > major || (s.Major == major && s.Minor >= minor)
+}
+
+func (s ServerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", s.Major, s.Minor, s.Patch)
+}
+
+// versionAdapter isolates the differences between Zoneminder releases
+type versionAdapter interface {
+	Name() string
+	Supports(version ServerVersion) bool
+	AuthModes() []AuthMode
+	LoginForm(credentials LoginCredentials) url.Values
+	ParseLogin(content []byte) (LoginDetails, error)
+	MonitorStatus() bool
+	EventTimeFields() (string, string)
+	NormalizeEvent(event *MonitorEvent)
+	ExportForm(event MonitorEvent, options ExportOptions, form url.Values)
+}
+
+// versionAdapters is ordered from the newest to the oldest supported release
+var versionAdapters = []versionAdapter{
+	zm136Adapter{},
+	zm134Adapter{},
+	zm132Adapter{},
+}
+
+func selectVersionAdapter(version ServerVersion) (versionAdapter, bool) {
+	for _, adapter := range versionAdapters {
+		if adapter.Supports(version) {
+			return adapter, true
+		}
+	}
+
+	return nil, false
+}
+
+type zm132Adapter struct{}
+
+func (s zm132Adapter) Name() string {
+	return "1.32"
+}
+
+func (s zm132Adapter) Supports(version ServerVersion) bool {
+	return version.AtLeast(1, 32) && !version.AtLeast(1, 34)
+}
+
+func (s zm132Adapter) AuthModes() []AuthMode {
+	return []AuthMode{AuthModeNone, AuthModeAuthHash}
+}
+
+func (s zm132Adapter) LoginForm(credentials LoginCredentials) url.Values {
+	return url.Values{
+		"user": []string{credentials.Username},
+		"pass": []string{credentials.Password},
+	}
+}
+
+// Zoneminder 1.32 only hands out auth hash credentials
+func (s zm132Adapter) ParseLogin(content []byte) (LoginDetails, error) {
+	var loginDetails LoginDetails
+	if err := json.Unmarshal(content, &loginDetails); err != nil {
+		return loginDetails, err
+	}
+
+	loginDetails.AccessToken = ""
+	loginDetails.RefreshToken = ""
+
+	return loginDetails, nil
+}
+
+func (s zm132Adapter) MonitorStatus() bool {
+	return false
+}
+
+func (s zm132Adapter) EventTimeFields() (string, string) {
+	return "StartTime", "EndTime"
+}
+
+func (s zm132Adapter) NormalizeEvent(event *MonitorEvent) {
+}
+
+func (s zm132Adapter) ExportForm(event MonitorEvent, options ExportOptions, form url.Values) {
+}
+
+type zm134Adapter struct {
+	zm132Adapter
+}
+
+func (s zm134Adapter) Name() string {
+	return "1.34"
+}
+
+func (s zm134Adapter) Supports(version ServerVersion) bool {
+	return version.AtLeast(1, 34) && !version.AtLeast(1, 36)
+}
+
+func (s zm134Adapter) AuthModes() []AuthMode {
+	return []AuthMode{AuthModeNone, AuthModeAuthHash, AuthModeToken, AuthModeAPIKey}
+}
+
+// Zoneminder 1.34 added access and refresh tokens to the login response
+func (s zm134Adapter) ParseLogin(content []byte) (LoginDetails, error) {
+	var loginDetails LoginDetails
+	err := json.Unmarshal(content, &loginDetails)
+
+	return loginDetails, err
+}
+
+func (s zm134Adapter) MonitorStatus() bool {
+	return true
+}
+
+type zm136Adapter struct {
+	zm134Adapter
+}
+
+func (s zm136Adapter) Name() string {
+	return "1.36+"
+}
+
+func (s zm136Adapter) Supports(version ServerVersion) bool {
+	return version.AtLeast(1, 36)
+}
+
+// Zoneminder 1.36 renamed the event StartTime and EndTime columns
+func (s zm136Adapter) EventTimeFields() (string, string) {
+	return "StartDateTime", "EndDateTime"
+}
+
+func (s zm136Adapter) NormalizeEvent(event *MonitorEvent) {
+	if len(event.StartTime) == 0 {
+		event.StartTime = event.StartDateTime
+	}
+
+	if len(event.EndTime) == 0 {
+		event.EndTime = event.EndDateTime
+	}
+}
+
+func (s zm136Adapter) ExportForm(event MonitorEvent, options ExportOptions, form url.Values) {
+	form.Set("exportStructure", "tree")
+	form.Set("exportFileName", fmt.Sprintf("Export-%s", event.ID))
+}
+
+const (
+	TimeZoneConfigured = "configured"
+	TimeZoneDetected   = "detected"
+	TimeZoneFallback   = "process timezone fallback"
+)
+
+type CompatibilityReport struct {
+	Server        string
+	ServerVersion string
+	APIVersion    string
+	Adapter       string
+	AuthMode      AuthMode
+	MonitorStatus bool
+	// TimeZone is the location Zoneminder timestamps are interpreted in and
+	// TimeZoneSource describes how it was determined
+	TimeZone       string
+	TimeZoneSource string
+	Issues         []string
+}
+
+func (s CompatibilityReport) Compatible() bool {
+	return len(s.Issues) == 0
+}
+
+func (s CompatibilityReport) String() string {
+	builder := &strings.Builder{}
+
+	fmt.Fprintf(builder, "Zoneminder %s compatibility report\n", s.Server)
+	fmt.Fprintf(builder, "   Server version   %s\n", s.ServerVersion)
+	fmt.Fprintf(builder, "   API version      %s\n", s.APIVersion)
+	fmt.Fprintf(builder, "   Adapter          %s\n", s.Adapter)
+	fmt.Fprintf(builder, "   Auth mode        %s\n", s.AuthMode)
+	fmt.Fprintf(builder, "   Monitor status   %t\n", s.MonitorStatus)
+	fmt.Fprintf(builder, "   Timezone         %s, %s", s.TimeZone, s.TimeZoneSource)
+
+	for _, issue := range s.Issues {
+		fmt.Fprintf(builder, "\n   Issue: %s", issue)
+	}
+
+	return builder.String()
+}
+
+type IncompatibleServerError struct {
+	Report CompatibilityReport
+}
+
+func (s IncompatibleServerError) Error() string {
+	return fmt.Sprintf("zoneminder server %s is not compatible: %s", s.Report.Server, strings.Join(s.Report.Issues, "; "))
+}
@@ -1,10 +1,18 @@
 package zmapi
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
 	"fmt"
+	"mime"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/zinic/forculus/errors"
 	"github.com/zinic/forculus/zoneminder/constants"
 )
 
@@ -13,9 +21,50 @@ type AlertedMonitor struct {
 	AlarmStatus AlarmStatus
 }
 
+// Snapshot is a single frame grabbed from the live stream of a monitor
+type Snapshot struct {
+	Monitor     Monitor
+	ContentType string
+	Image       []byte
+	CapturedAt  time.Time
+}
+
+// Extension returns the file extension matching the content type of the
+// snapshot, or an empty string when the type is not recognized
+func (s Snapshot) Extension() string {
+	mediaType, _, err := mime.ParseMediaType(s.ContentType)
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case "image/jpeg":
+		return ".jpg"
+
+	case "image/png":
+		return ".png"
+
+	case "image/gif":
+		return ".gif"
+	}
+
+	if extensions, err := mime.ExtensionsByType(mediaType); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+
+	return ""
+}
+
+// Filename names the snapshot after its monitor and capture time
+func (s Snapshot) Filename() string {
+	return fmt.Sprintf("%s-%s%s", s.Monitor.Details.Name, s.CapturedAt.Format("20060102-150405"), s.Extension())
+}
+
 type LoginCredentials struct {
+	Mode     AuthMode
 	Username string
 	Password string
+	APIKey   string
 }
 
 type LoginDetails struct {
@@ -50,6 +99,7 @@ type MonitorEvent struct {
 	DiskSpace          string `json:"DiskSpace"`
 	Emailed            string `json:"Emailed"`
 	EndTime            string `json:"EndTime"`
+	EndDateTime        string `json:"EndDateTime"`
 	Executed           string `json:"Executed"`
 	FileSystemPath     string `json:"FileSystemPath"`
 	Frames             string `json:"Frames"`
@@ -67,6 +117,7 @@ type MonitorEvent struct {
 	SaveJPEGs          string `json:"SaveJPEGs"`
 	Scheme             string `json:"Scheme"`
 	SecondaryStorageID string `json:"SecondaryStorageId"`
+	StartDateTime      string `json:"StartDateTime"`
 	StartTime          string `json:"StartTime"`
 	StateID            string `json:"StateId"`
 	StorageID          string `json:"StorageId"`
@@ -74,6 +125,29 @@ type MonitorEvent struct {
 	Uploaded           string `json:"Uploaded"`
 	Videoed            string `json:"Videoed"`
 	Width              string `json:"Width"`
+
+	// Server is the name of the Zoneminder server the event was listed from
+	Server string `json:"-"`
+
+	// Zones lists the names of the zones that triggered the event, parsed from
+	// the event notes
+	Zones []string `json:"-"`
+
+	// Groups lists the names of the groups the event's monitor belongs to
+	Groups []string `json:"-"`
+
+	// Location is the timezone of the Zoneminder server the event was listed
+	// from. Event timestamps carry no zone of their own.
+	Location *time.Location `json:"-"`
+}
+
+func (s MonitorEvent) ParseID() (int64, error) {
+	return strconv.ParseInt(s.ID, 10, 64)
+}
+
+// Closed reports whether Zoneminder has finished recording the event
+func (s MonitorEvent) Closed() bool {
+	return len(s.EndTime) > 0 && !strings.HasPrefix(s.EndTime, "0000")
 }
 
 func (s MonitorEvent) ParseAlertFrames() (int, error) {
@@ -84,12 +158,85 @@ func (s MonitorEvent) String() string {
 	return fmt.Sprintf("%s:%s", s.Name, s.ID)
 }
 
+// monitorEventState carries the fields of a MonitorEvent that are not part of
+// its JSON form so that the event survives being written to disk
+type monitorEventState struct {
+	Event    []byte
+	Server   string
+	Zones    []string
+	Groups   []string
+	TimeZone string
+}
+
+func (s MonitorEvent) GobEncode() ([]byte, error) {
+	state := monitorEventState{
+		Server: s.Server,
+		Zones:  s.Zones,
+		Groups: s.Groups,
+	}
+
+	if s.Location != nil {
+		state.TimeZone = s.Location.String()
+	}
+
+	if encoded, err := json.Marshal(s); err != nil {
+		return nil, err
+	} else {
+		state.Event = encoded
+	}
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(state); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (s *MonitorEvent) GobDecode(content []byte) error {
+	var state monitorEventState
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&state); err != nil {
+		return err
+	} else if err := json.Unmarshal(state.Event, s); err != nil {
+		return err
+	}
+
+	s.Server = state.Server
+	s.Zones = state.Zones
+	s.Groups = state.Groups
+
+	if len(state.TimeZone) > 0 {
+		if location, err := time.LoadLocation(state.TimeZone); err == nil {
+			s.Location = location
+		}
+	}
+
+	return nil
+}
+
+func (s MonitorEvent) location() *time.Location {
+	if s.Location == nil {
+		return time.Local
+	}
+
+	return s.Location
+}
+
 func (s MonitorEvent) ParseStartTime() (time.Time, error) {
-	return time.Parse(constants.ZMDateFormat, s.StartTime)
+	return time.ParseInLocation(constants.ZMDateFormat, s.StartTime, s.location())
 }
 
 func (s MonitorEvent) ParseEndTime() (time.Time, error) {
-	return time.Parse(constants.ZMDateFormat, s.EndTime)
+	return time.ParseInLocation(constants.ZMDateFormat, s.EndTime, s.location())
+}
+
+// FormatStartTime renders the event start time with its timezone for display
+func (s MonitorEvent) FormatStartTime() string {
+	if startTime, err := s.ParseStartTime(); err != nil {
+		return s.StartTime
+	} else {
+		return startTime.Format("2006-01-02 15:04:05 MST")
+	}
 }
 
 type PaginationDetails struct {
@@ -110,6 +257,10 @@ type EventWrapper struct {
 	Event MonitorEvent `json:"Event"`
 }
 
+type ViewEventResponse struct {
+	Event EventWrapper `json:"event"`
+}
+
 type MonitorList []Monitor
 
 type ListMonitorsResponse struct {
@@ -219,6 +370,68 @@ func (s MonitorDetails) ParseAlertFrameCount() (int, error) {
 	return strconv.Atoi(s.AlarmFrameCount)
 }
 
+type ExportFormat string
+
+const (
+	ExportFormatTar ExportFormat = "tar"
+	ExportFormatZip ExportFormat = "zip"
+)
+
+func ParseExportFormat(raw string) (ExportFormat, error) {
+	switch ExportFormat(strings.ToLower(raw)) {
+	case "", ExportFormatTar:
+		return ExportFormatTar, nil
+
+	case ExportFormatZip:
+		return ExportFormatZip, nil
+
+	default:
+		return "", fmt.Errorf("unsupported export format %s", raw)
+	}
+}
+
+type ExportOptions struct {
+	Detail   bool
+	Frames   bool
+	Images   bool
+	Video    bool
+	Misc     bool
+	Format   ExportFormat
+	Compress bool
+}
+
+func DefaultExportOptions() ExportOptions {
+	return ExportOptions{
+		Detail:   true,
+		Frames:   true,
+		Images:   true,
+		Video:    true,
+		Misc:     true,
+		Format:   ExportFormatTar,
+		Compress: true,
+	}
+}
+
+// Extension returns the file extension of the archive Zoneminder produces for
+// these options
+func (s ExportOptions) Extension() string {
+	if s.Format == ExportFormatZip {
+		return "zip"
+	} else if s.Compress {
+		return "tar.gz"
+	}
+
+	return "tar"
+}
+
+func formatExportFlag(enabled bool) string {
+	if enabled {
+		return "1"
+	}
+
+	return "0"
+}
+
 type ExportEventResult struct {
 	Result     string `json:"result"`
 	ExportFile string `json:"exportFile"`
@@ -235,12 +448,122 @@ type MonitorStatus struct {
 type Monitor struct {
 	Details MonitorDetails `json:"Monitor"`
 	Status  MonitorStatus  `json:"Monitor_Status"`
+
+	// Server is the name of the Zoneminder server the monitor was listed from
+	Server string `json:"-"`
+
+	// Groups lists the names of the groups the monitor belongs to, including
+	// the parents of those groups
+	Groups []string `json:"-"`
+}
+
+// ConfigChanges lists the configuration fields that differ from the other
+// monitor details. Event counters, which change as events are recorded, are
+// ignored.
+func (s MonitorDetails) ConfigChanges(other MonitorDetails) []string {
+	var (
+		changes     []string
+		current     = reflect.ValueOf(s)
+		previous    = reflect.ValueOf(other)
+		detailsType = current.Type()
+	)
+
+	for idx := 0; idx < detailsType.NumField(); idx++ {
+		fieldName := detailsType.Field(idx).Name
+		if strings.HasSuffix(fieldName, "Events") || strings.HasSuffix(fieldName, "EventDiskSpace") {
+			continue
+		}
+
+		if !reflect.DeepEqual(current.Field(idx).Interface(), previous.Field(idx).Interface()) {
+			changes = append(changes, fieldName)
+		}
+	}
+
+	return changes
 }
 
 func (s Monitor) Name() string {
 	return fmt.Sprintf("%s(id:%s)", s.Details.Name, s.Details.ID)
 }
 
+func (s Monitor) Active() bool {
+	return s.Details.Enabled == "1" && s.Details.Function != MonitorFunctionNone
+}
+
+func (s Monitor) Connected() bool {
+	return s.Status.State == MonitorStateConnected || s.Status.State == MonitorStateRunning
+}
+
+func (s Monitor) ParseCaptureFPS() (float64, error) {
+	return strconv.ParseFloat(s.Status.CaptureFPS, 64)
+}
+
+const (
+	MonitorFunctionNone = "None"
+
+	MonitorStateConnected  = "Connected"
+	MonitorStateRunning    = "Running"
+	MonitorStateNotRunning = "NotRunning"
+	MonitorStateSignal     = "Signal"
+)
+
+type HostLoad struct {
+	Load []float64 `json:"load"`
+}
+
+// OneMinute returns the one minute load average reported by the host
+func (s HostLoad) OneMinute() float64 {
+	if len(s.Load) == 0 {
+		return 0
+	}
+
+	return s.Load[0]
+}
+
+const (
+	ErrDiskPercentUnavailable = errors.New("disk usage is not reported as a percentage")
+)
+
+// HostDiskPercent captures the output of host/getDiskPercent.json. Despite its
+// name, since 1.32 the usage field is a map of storage areas including a Total
+// whose space is the number of gigabytes used rather than a percentage. Older
+// releases report a bare percentage or a percentage string (e.g. "42%").
+type HostDiskPercent struct {
+	Usage interface{} `json:"usage"`
+}
+
+func parsePercent(value interface{}) (float64, error) {
+	switch typedValue := value.(type) {
+	case float64:
+		return typedValue, nil
+
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(typedValue, "%")), 64)
+
+	default:
+		return 0, fmt.Errorf("unexpected disk usage value %v", value)
+	}
+}
+
+// TotalPercent returns the reported disk usage when it is a percentage. Usage
+// reported per storage area is space used, which says nothing about how full
+// the disk is, so ErrDiskPercentUnavailable is returned instead.
+func (s HostDiskPercent) TotalPercent() (float64, error) {
+	if _, isMap := s.Usage.(map[string]interface{}); isMap {
+		return 0, ErrDiskPercentUnavailable
+	}
+
+	return parsePercent(s.Usage)
+}
+
+type DaemonCheckResult struct {
+	Result int `json:"result"`
+}
+
+func (s DaemonCheckResult) Running() bool {
+	return s.Result == 1
+}
+
 type MonitorAlarmStatus struct {
 	Status string `json:"status"`
 }
@@ -299,3 +622,367 @@ func ParseAlarmStatus(raw string) AlarmStatus {
 		return AlarmStatusInvalid
 	}
 }
+
+type RunStateList []RunState
+
+type ListRunStatesResponse struct {
+	States []RunStateWrapper `json:"states"`
+}
+
+type RunStateWrapper struct {
+	State RunState `json:"State"`
+}
+
+type RunState struct {
+	ID         string `json:"Id"`
+	Name       string `json:"Name"`
+	Definition string `json:"Definition"`
+	IsActive   string `json:"IsActive"`
+}
+
+func (s RunState) Active() bool {
+	return s.IsActive == "1"
+}
+
+func (s RunStateList) Active() (RunState, bool) {
+	for _, runState := range s {
+		if runState.Active() {
+			return runState, true
+		}
+	}
+
+	return RunState{}, false
+}
+
+type DaemonCommand string
+
+const (
+	DaemonStart   DaemonCommand = "start"
+	DaemonStop    DaemonCommand = "stop"
+	DaemonRestart DaemonCommand = "restart"
+)
+
+func ParseDaemonCommand(raw string) (DaemonCommand, bool) {
+	switch DaemonCommand(strings.ToLower(raw)) {
+	case DaemonStart:
+		return DaemonStart, true
+
+	case DaemonStop:
+		return DaemonStop, true
+
+	case DaemonRestart:
+		return DaemonRestart, true
+
+	default:
+		return "", false
+	}
+}
+
+type StorageList []Storage
+
+type ListStorageResponse struct {
+	Storage []StorageWrapper `json:"storage"`
+}
+
+type StorageWrapper struct {
+	Storage Storage `json:"Storage"`
+}
+
+type Storage struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Path   string `json:"Path"`
+	Type   string `json:"Type"`
+	Scheme string `json:"Scheme"`
+
+	// Space used and available in bytes. Not every release reports the total.
+	DiskSpace      json.Number `json:"DiskSpace"`
+	DiskTotalSpace json.Number `json:"DiskTotalSpace"`
+}
+
+// UsagePercent returns how full the storage areas are together. It returns
+// false when none of the areas report both their used and total space.
+func (s StorageList) UsagePercent() (float64, bool) {
+	var used, total float64
+
+	for _, storage := range s {
+		if usedSpace, err := storage.DiskSpace.Float64(); err != nil {
+			continue
+		} else if totalSpace, err := storage.DiskTotalSpace.Float64(); err != nil || totalSpace <= 0 {
+			continue
+		} else {
+			used += usedSpace
+			total += totalSpace
+		}
+	}
+
+	if total <= 0 {
+		return 0, false
+	}
+
+	return used / total * 100, true
+}
+
+const (
+	StorageSchemeDeep    = "Deep"
+	StorageSchemeMedium  = "Medium"
+	StorageSchemeShallow = "Shallow"
+)
+
+type TimeZoneResponse struct {
+	TimeZone string `json:"tz"`
+}
+
+type ViewConfigResponse struct {
+	Config struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	} `json:"config"`
+}
+
+type Zone struct {
+	ID        string `json:"Id"`
+	MonitorID string `json:"MonitorId"`
+	Name      string `json:"Name"`
+	Type      string `json:"Type"`
+	Units     string `json:"Units"`
+	Coords    string `json:"Coords"`
+	Area      string `json:"Area"`
+}
+
+type ZoneWrapper struct {
+	Zone Zone `json:"Zone"`
+}
+
+type ZoneList []Zone
+
+type ListZonesResponse struct {
+	Zones []ZoneWrapper `json:"zones"`
+}
+
+// Names returns the names of the zones that belong to the monitor
+func (s ZoneList) Names(monitorID string) []string {
+	var names []string
+	for _, zone := range s {
+		if zone.MonitorID == monitorID {
+			names = append(names, zone.Name)
+		}
+	}
+
+	return names
+}
+
+const motionNotesCause = "Motion: "
+
+// notesCauses are the other causes Zoneminder records in event notes
+var notesCauses = []string{"Linked", "Forced Web", "Signal", "Continuous", "Trigger"}
+
+// ParseTriggeredZones extracts the zones listed for the motion cause in event
+// notes such as "Motion: Driveway, Porch". Zoneminder does not separate
+// multiple causes, so when the monitor's zone names are known they are
+// matched directly and parsing stops at the first text that is not a zone.
+func ParseTriggeredZones(notes string, knownZones []string) []string {
+	causeIdx := strings.Index(notes, motionNotesCause)
+	if causeIdx < 0 {
+		return nil
+	}
+
+	var (
+		zones   []string
+		section = notes[causeIdx+len(motionNotesCause):]
+	)
+
+	if len(knownZones) == 0 {
+		for _, zone := range strings.Split(section, ", ") {
+			// Another cause follows the last zone
+			if causeIdx := strings.Index(zone, ": "); causeIdx >= 0 {
+				zone = zone[:causeIdx]
+
+				for _, cause := range notesCauses {
+					if strings.HasSuffix(zone, cause) {
+						zone = strings.TrimSuffix(zone, cause)
+						break
+					}
+				}
+
+				if zone = strings.TrimSpace(zone); len(zone) > 0 {
+					zones = append(zones, zone)
+				}
+
+				break
+			}
+
+			if zone = strings.TrimSpace(zone); len(zone) > 0 {
+				zones = append(zones, zone)
+			}
+		}
+
+		return zones
+	}
+
+	// Prefer the longest names so that a zone named "Drive" does not shadow
+	// one named "Driveway"
+	candidates := append([]string(nil), knownZones...)
+	sort.Slice(candidates, func(i, j int) bool {
+		return len(candidates[i]) > len(candidates[j])
+	})
+
+	for matched := true; matched && len(section) > 0; {
+		matched = false
+		section = strings.TrimPrefix(section, ", ")
+
+		for _, candidate := range candidates {
+			if strings.HasPrefix(section, candidate) {
+				zones = append(zones, candidate)
+				section = section[len(candidate):]
+				matched = true
+				break
+			}
+		}
+	}
+
+	return zones
+}
+
+type Group struct {
+	ID       string `json:"Id"`
+	Name     string `json:"Name"`
+	ParentID string `json:"ParentId"`
+}
+
+type GroupMonitor struct {
+	ID string `json:"Id"`
+}
+
+type GroupWrapper struct {
+	Group    Group          `json:"Group"`
+	Monitors []GroupMonitor `json:"Monitor"`
+}
+
+type GroupList []GroupWrapper
+
+type ListGroupsResponse struct {
+	Groups GroupList `json:"groups"`
+}
+
+// MonitorGroups maps monitor IDs to the names of the groups they belong to.
+// Membership of a subgroup implies membership of its parent groups.
+func (s GroupList) MonitorGroups() map[string][]string {
+	var (
+		groupsByID    = make(map[string]Group, len(s))
+		monitorGroups = make(map[string][]string)
+	)
+
+	for _, groupWrapper := range s {
+		groupsByID[groupWrapper.Group.ID] = groupWrapper.Group
+	}
+
+	for _, groupWrapper := range s {
+		var names []string
+
+		// Walk up the group tree, guarding against malformed parent loops
+		visited := make(map[string]struct{})
+		for group, exists := groupWrapper.Group, true; exists; group, exists = groupsByID[group.ParentID] {
+			if _, seen := visited[group.ID]; seen {
+				break
+			}
+
+			visited[group.ID] = struct{}{}
+			names = append(names, group.Name)
+		}
+
+		for _, monitor := range groupWrapper.Monitors {
+			monitorGroups[monitor.ID] = appendUnique(monitorGroups[monitor.ID], names...)
+		}
+	}
+
+	return monitorGroups
+}
+
+func appendUnique(values []string, additions ...string) []string {
+	for _, addition := range additions {
+		found := false
+		for _, value := range values {
+			if value == addition {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			values = append(values, addition)
+		}
+	}
+
+	return values
+}
+
+// Log level codes Zoneminder records with each log line
+const (
+	LogCodeDebug   = "DBG"
+	LogCodeInfo    = "INF"
+	LogCodeWarning = "WAR"
+	LogCodeError   = "ERR"
+	LogCodeFatal   = "FAT"
+	LogCodePanic   = "PNC"
+)
+
+// LogEntry is a single line of Zoneminder's own log. Numeric columns are kept
+// as json.Number since their encoding depends on the PHP database driver.
+type LogEntry struct {
+	TimeKey   json.Number `json:"TimeKey"`
+	Component string      `json:"Component"`
+	ServerID  json.Number `json:"ServerId"`
+	PID       json.Number `json:"Pid"`
+	Code      string      `json:"Code"`
+	Message   string      `json:"Message"`
+	File      string      `json:"File"`
+	Line      json.Number `json:"Line"`
+}
+
+// Time converts the fractional epoch timestamp of the log line
+func (s LogEntry) Time() (time.Time, error) {
+	if timeKey, err := strconv.ParseFloat(s.TimeKey.String(), 64); err != nil {
+		return time.Time{}, err
+	} else {
+		seconds := int64(timeKey)
+		return time.Unix(seconds, int64((timeKey-float64(seconds))*float64(time.Second))), nil
+	}
+}
+
+// Key identifies a log line. Zoneminder does not return log IDs so the
+// timestamp, process and message are combined instead.
+func (s LogEntry) Key() string {
+	return fmt.Sprintf("%s/%s/%s", s.TimeKey, s.PID, s.Message)
+}
+
+// MonitorID returns the monitor a per-monitor daemon such as zmc_m3 logged
+// for, or an empty string for components that are not tied to a monitor
+func (s LogEntry) MonitorID() string {
+	if idx := strings.LastIndex(s.Component, "_m"); idx >= 0 {
+		if monitorID := s.Component[idx+2:]; len(monitorID) > 0 {
+			if _, err := strconv.Atoi(monitorID); err == nil {
+				return monitorID
+			}
+		}
+	}
+
+	return ""
+}
+
+type LogWrapper struct {
+	Log LogEntry `json:"Log"`
+}
+
+type LogList []LogEntry
+
+type ListLogsResponse struct {
+	Logs       []LogWrapper      `json:"logs"`
+	Pagination PaginationDetails `json:"pagination"`
+}
+
+// LogPage is one page of Zoneminder logs, newest first
+type LogPage struct {
+	Entries  LogList
+	NextPage bool
+}
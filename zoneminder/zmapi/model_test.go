@@ -0,0 +1,121 @@
+package zmapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTriggeredZones(t *testing.T) {
+	cases := []struct {
+		name       string
+		notes      string
+		knownZones []string
+		expected   []string
+	}{
+		{
+			name:     "no notes",
+			notes:    "",
+			expected: nil,
+		},
+		{
+			name:     "no motion cause",
+			notes:    "Forced Web: admin",
+			expected: nil,
+		},
+		{
+			name:     "unknown zones",
+			notes:    "Motion: Driveway, Porch",
+			expected: []string{"Driveway", "Porch"},
+		},
+		{
+			name:     "unknown zones followed by another cause",
+			notes:    "Motion: Driveway, PorchLinked: Front Door",
+			expected: []string{"Driveway", "Porch"},
+		},
+		{
+			name:     "motion after another cause",
+			notes:    "Signal: Motion: Porch",
+			expected: []string{"Porch"},
+		},
+		{
+			name:       "known zones",
+			notes:      "Motion: Driveway, Porch",
+			knownZones: []string{"Porch", "Driveway", "Garden"},
+			expected:   []string{"Driveway", "Porch"},
+		},
+		{
+			name:       "known zone that prefixes another",
+			notes:      "Motion: Driveway, Drive",
+			knownZones: []string{"Drive", "Driveway"},
+			expected:   []string{"Driveway", "Drive"},
+		},
+		{
+			name:       "known zone containing a separator",
+			notes:      "Motion: Front, Back Yard, Porch",
+			knownZones: []string{"Porch", "Front, Back Yard"},
+			expected:   []string{"Front, Back Yard", "Porch"},
+		},
+		{
+			name:       "known zones followed by another cause",
+			notes:      "Motion: PorchSignal: lost",
+			knownZones: []string{"Porch"},
+			expected:   []string{"Porch"},
+		},
+		{
+			name:       "unmatched zone",
+			notes:      "Motion: Renamed Zone",
+			knownZones: []string{"Porch"},
+			expected:   nil,
+		},
+	}
+
+	for _, testCase := range cases {
+		if zones := ParseTriggeredZones(testCase.notes, testCase.knownZones); !reflect.DeepEqual(zones, testCase.expected) {
+			t.Errorf("%s: expected %v but got %v", testCase.name, testCase.expected, zones)
+		}
+	}
+}
+
+func TestGroupListMonitorGroups(t *testing.T) {
+	groups := GroupList{
+		{
+			Group:    Group{ID: "1", Name: "Outside"},
+			Monitors: []GroupMonitor{{ID: "10"}},
+		},
+		{
+			Group:    Group{ID: "2", Name: "Front", ParentID: "1"},
+			Monitors: []GroupMonitor{{ID: "10"}, {ID: "11"}},
+		},
+		{
+			Group:    Group{ID: "3", Name: "Porch", ParentID: "2"},
+			Monitors: []GroupMonitor{{ID: "12"}},
+		},
+		{
+			Group:    Group{ID: "4", Name: "Orphan", ParentID: "99"},
+			Monitors: []GroupMonitor{{ID: "13"}},
+		},
+		{
+			Group:    Group{ID: "5", Name: "Loop A", ParentID: "6"},
+			Monitors: []GroupMonitor{{ID: "14"}},
+		},
+		{
+			Group: Group{ID: "6", Name: "Loop B", ParentID: "5"},
+		},
+	}
+
+	expected := map[string][]string{
+		"10": {"Outside", "Front"},
+		"11": {"Front", "Outside"},
+		"12": {"Porch", "Front", "Outside"},
+		"13": {"Orphan"},
+		"14": {"Loop A", "Loop B"},
+	}
+
+	if monitorGroups := groups.MonitorGroups(); !reflect.DeepEqual(monitorGroups, expected) {
+		t.Errorf("expected %v but got %v", expected, monitorGroups)
+	}
+
+	if monitorGroups := (GroupList{}).MonitorGroups(); len(monitorGroups) != 0 {
+		t.Errorf("expected no memberships for an empty group list but got %v", monitorGroups)
+	}
+}
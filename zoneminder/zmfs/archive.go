@@ -0,0 +1,163 @@
+package zmfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+const eventDetailFilename = "event.json"
+
+type archiveWriter interface {
+	WriteFile(name string, size int64, modTime time.Time, content io.Reader) error
+	Close() error
+}
+
+type tarArchiveWriter struct {
+	tarWriter  *tar.Writer
+	gzipWriter *gzip.Writer
+}
+
+func newTarArchiveWriter(output io.Writer, compress bool) *tarArchiveWriter {
+	if compress {
+		gzipWriter := gzip.NewWriter(output)
+
+		return &tarArchiveWriter{
+			tarWriter:  tar.NewWriter(gzipWriter),
+			gzipWriter: gzipWriter,
+		}
+	}
+
+	return &tarArchiveWriter{
+		tarWriter: tar.NewWriter(output),
+	}
+}
+
+func (s *tarArchiveWriter) WriteFile(name string, size int64, modTime time.Time, content io.Reader) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	}
+
+	if err := s.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(s.tarWriter, content)
+	return err
+}
+
+func (s *tarArchiveWriter) Close() error {
+	if err := s.tarWriter.Close(); err != nil {
+		return err
+	}
+
+	if s.gzipWriter != nil {
+		return s.gzipWriter.Close()
+	}
+
+	return nil
+}
+
+type zipArchiveWriter struct {
+	zipWriter *zip.Writer
+	method    uint16
+}
+
+func newZipArchiveWriter(output io.Writer, compress bool) *zipArchiveWriter {
+	method := zip.Store
+	if compress {
+		method = zip.Deflate
+	}
+
+	return &zipArchiveWriter{
+		zipWriter: zip.NewWriter(output),
+		method:    method,
+	}
+}
+
+func (s *zipArchiveWriter) WriteFile(name string, size int64, modTime time.Time, content io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   s.method,
+		Modified: modTime,
+	}
+
+	if writer, err := s.zipWriter.CreateHeader(header); err != nil {
+		return err
+	} else {
+		_, err := io.Copy(writer, content)
+		return err
+	}
+}
+
+func (s *zipArchiveWriter) Close() error {
+	return s.zipWriter.Close()
+}
+
+func writeEventFile(archive archiveWriter, archiveDir, eventPath, filename string) error {
+	file, err := os.Open(filepath.Join(eventPath, filename))
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if info, err := file.Stat(); err != nil {
+		return err
+	} else {
+		return archive.WriteFile(filepath.Join(archiveDir, filename), info.Size(), info.ModTime(), file)
+	}
+}
+
+func writeArchive(output io.Writer, event zmapi.MonitorEvent, eventPath string, files []string, options zmapi.ExportOptions) error {
+	var (
+		archive    archiveWriter
+		archiveDir = event.ID
+	)
+
+	if options.Format == zmapi.ExportFormatZip {
+		archive = newZipArchiveWriter(output, options.Compress)
+	} else {
+		archive = newTarArchiveWriter(output, options.Compress)
+	}
+
+	if options.Detail {
+		if detail, err := json.MarshalIndent(event, "", "  "); err != nil {
+			return fmt.Errorf("failed to marshal event %s details: %w", event.ID, err)
+		} else if err := archive.WriteFile(filepath.Join(archiveDir, eventDetailFilename), int64(len(detail)), time.Now(), bytes.NewReader(detail)); err != nil {
+			return err
+		}
+	}
+
+	for _, filename := range files {
+		if err := writeEventFile(archive, archiveDir, eventPath, filename); err != nil {
+			return fmt.Errorf("failed to archive event %s file %s: %w", event.ID, filename, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// newArchiveStream builds the event archive in the background, streaming it
+// to the returned reader as it is written
+func newArchiveStream(event zmapi.MonitorEvent, eventPath string, files []string, options zmapi.ExportOptions) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(writeArchive(writer, event, eventPath, files, options))
+	}()
+
+	return reader
+}
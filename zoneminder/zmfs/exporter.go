@@ -0,0 +1,218 @@
+package zmfs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/zinic/forculus/log"
+	"github.com/zinic/forculus/zoneminder/zmapi"
+)
+
+const (
+	DefaultEventsPath = "/var/cache/zoneminder/events"
+
+	// Events recorded before storage areas existed reference storage ID 0,
+	// which maps to the ZM_DIR_EVENTS directory
+	defaultStorageID = "0"
+)
+
+// Exporter reads events directly from the Zoneminder storage areas instead of
+// exporting them over HTTP. It is meant for deployments where the eventserver
+// runs on the Zoneminder host.
+type Exporter struct {
+	client       zmapi.Client
+	eventsPath   string
+	storagePaths map[string]string
+	storageAreas map[string]zmapi.Storage
+	lock         *sync.Mutex
+}
+
+func NewExporter(client zmapi.Client, eventsPath string, storagePaths map[string]string) zmapi.EventExporter {
+	if len(eventsPath) == 0 {
+		eventsPath = DefaultEventsPath
+	}
+
+	return &Exporter{
+		client:       client,
+		eventsPath:   eventsPath,
+		storagePaths: storagePaths,
+		lock:         &sync.Mutex{},
+	}
+}
+
+func (s *Exporter) storageArea(storageID string) (zmapi.Storage, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if storage, found := s.storageAreas[storageID]; found {
+		return storage, true
+	} else if s.storageAreas != nil && storageID == defaultStorageID {
+		// The default storage area is usually not listed by the API
+		return storage, false
+	}
+
+	// Unknown storage areas may have been added since the last listing
+	if storageAreas, err := s.client.StorageAreas(); err != nil {
+		log.Errorf("Failed to list storage areas for %s: %v", s.client.Name(), err)
+	} else {
+		s.storageAreas = make(map[string]zmapi.Storage, len(storageAreas))
+
+		for _, storage := range storageAreas {
+			s.storageAreas[storage.ID] = storage
+		}
+	}
+
+	storage, found := s.storageAreas[storageID]
+	return storage, found
+}
+
+func (s *Exporter) storageRoot(storageID string) (string, string) {
+	if len(storageID) == 0 {
+		storageID = defaultStorageID
+	}
+
+	storage, hasStorage := s.storageArea(storageID)
+
+	if overridePath, hasOverride := s.storagePaths[storageID]; hasOverride {
+		return overridePath, storage.Scheme
+	} else if hasStorage && len(storage.Path) > 0 {
+		return storage.Path, storage.Scheme
+	}
+
+	return s.eventsPath, storage.Scheme
+}
+
+// EventPath resolves the directory holding the files of the given event
+func (s *Exporter) EventPath(event zmapi.MonitorEvent) (string, error) {
+	if len(event.FileSystemPath) > 0 {
+		if info, err := os.Stat(event.FileSystemPath); err == nil && info.IsDir() {
+			return event.FileSystemPath, nil
+		}
+	}
+
+	storageRoot, scheme := s.storageRoot(event.StorageID)
+	if len(event.Scheme) > 0 {
+		scheme = event.Scheme
+	}
+
+	var eventPath string
+
+	switch scheme {
+	case zmapi.StorageSchemeShallow:
+		eventPath = filepath.Join(storageRoot, event.MonitorID, event.ID)
+
+	case zmapi.StorageSchemeMedium:
+		if startTime, err := event.ParseStartTime(); err != nil {
+			return "", err
+		} else {
+			eventPath = filepath.Join(storageRoot, event.MonitorID, startTime.Format("2006-01-02"), event.ID)
+		}
+
+	default:
+		// Deep storage is the Zoneminder default
+		if startTime, err := event.ParseStartTime(); err != nil {
+			return "", err
+		} else {
+			eventPath = filepath.Join(storageRoot, event.MonitorID, startTime.Format("06/01/02/15/04/05"))
+		}
+	}
+
+	if info, err := os.Stat(eventPath); err != nil {
+		return "", fmt.Errorf("event %s directory is not readable: %w", event.ID, err)
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("event %s path %s is not a directory", event.ID, eventPath)
+	}
+
+	return eventPath, nil
+}
+
+func (s *Exporter) ExportEvent(event zmapi.MonitorEvent, options zmapi.ExportOptions) (io.ReadCloser, error) {
+	if eventPath, err := s.EventPath(event); err != nil {
+		return nil, err
+	} else if files, err := selectEventFiles(eventPath, options); err != nil {
+		return nil, err
+	} else {
+		return newArchiveStream(event, eventPath, files, options), nil
+	}
+}
+
+func (s *Exporter) DownloadMP4(event zmapi.MonitorEvent) (io.ReadCloser, error) {
+	eventPath, err := s.EventPath(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(event.DefaultVideo) > 0 {
+		return os.Open(filepath.Join(eventPath, filepath.Base(event.DefaultVideo)))
+	}
+
+	if matches, err := filepath.Glob(filepath.Join(eventPath, "*.mp4")); err != nil {
+		return nil, err
+	} else if len(matches) == 0 {
+		return nil, fmt.Errorf("event %s has no video file in %s", event.ID, eventPath)
+	} else {
+		return os.Open(matches[0])
+	}
+}
+
+type fileCategory int
+
+const (
+	categoryImage fileCategory = iota
+	categoryVideo
+	categoryMisc
+)
+
+func categorize(name string) fileCategory {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return categoryImage
+
+	case ".mp4", ".mkv", ".avi", ".webm":
+		return categoryVideo
+
+	default:
+		return categoryMisc
+	}
+}
+
+func selectEventFiles(eventPath string, options zmapi.ExportOptions) ([]string, error) {
+	var selected []string
+
+	entries, err := ioutil.ReadDir(eventPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		switch categorize(entry.Name()) {
+		case categoryImage:
+			if !options.Images && !options.Frames {
+				continue
+			}
+
+		case categoryVideo:
+			if !options.Video {
+				continue
+			}
+
+		default:
+			if !options.Misc {
+				continue
+			}
+		}
+
+		selected = append(selected, entry.Name())
+	}
+
+	return selected, nil
+}